@@ -0,0 +1,193 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"filippo.io/edwards25519"
+)
+
+const (
+	// minBatchSignatures is the smallest number of signatures verified as a
+	// batch; fewer are faster to verify one by one.
+	minBatchSignatures = 4
+	// minParallelSignatures is the smallest number of signatures per worker;
+	// fewer aren't worth the overhead of the workers.
+	minParallelSignatures = 16
+)
+
+type batchEntry struct {
+	pubKey ed25519.PublicKey
+	msg    []byte
+	sig    []byte
+}
+
+// BatchVerifier collects ed25519 signatures and verifies all of them together.
+// Instead of checking the equation [s]B = R + [k]A of every signature, it
+// checks a random linear combination of all of them with a single multiscalar
+// multiplication, which is a lot cheaper per signature. The signatures are
+// split among a pool of workers, each verifying its share as one batch.
+//
+// The equations are multiplied by the cofactor, also when the signatures are
+// verified one by one, so the result doesn't depend on how the signatures are
+// batched. This only differs from ed25519.Verify for signatures crafted with
+// points of small order.
+type BatchVerifier struct {
+	workers int
+	entries []batchEntry
+}
+
+// NewBatchVerifier returns a verifier using the number of workers, or one per
+// CPU if workers isn't positive.
+func NewBatchVerifier(workers int) *BatchVerifier {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &BatchVerifier{
+		workers: workers,
+	}
+}
+
+// Add adds the signature of the message by the public key to the verifier.
+func (v *BatchVerifier) Add(pubKey *PublicKey, msg []byte, sig *Signature) {
+	v.entries = append(v.entries, batchEntry{
+		pubKey: pubKey.key,
+		msg:    msg,
+		sig:    sig.value,
+	})
+}
+
+// Len returns the number of signatures added to the verifier.
+func (v *BatchVerifier) Len() int {
+	return len(v.entries)
+}
+
+// Verify reports whether all the added signatures are valid. It doesn't tell
+// which signature is invalid, that takes verifying them one by one.
+func (v *BatchVerifier) Verify() bool {
+	workers := min(v.workers, len(v.entries)/minParallelSignatures)
+	if workers <= 1 {
+		return verifyBatch(v.entries)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		invalid atomic.Bool
+		size    = (len(v.entries) + workers - 1) / workers
+	)
+	for start := 0; start < len(v.entries); start += size {
+		entries := v.entries[start:min(start+size, len(v.entries))]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !verifyBatch(entries) {
+				invalid.Store(true)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return !invalid.Load()
+}
+
+// parsedEntry holds the points and scalars of the equation of a signature.
+type parsedEntry struct {
+	pubKey, r *edwards25519.Point
+	// k is the challenge SHA-512(R || A || M).
+	s, k *edwards25519.Scalar
+}
+
+func parseEntry(e batchEntry) (parsedEntry, bool) {
+	pubKey, err := new(edwards25519.Point).SetBytes(e.pubKey)
+	if err != nil {
+		return parsedEntry{}, false
+	}
+	// ed25519.Verify compares the encoding of R, which rejects the
+	// non-canonical ones.
+	r, err := new(edwards25519.Point).SetBytes(e.sig[:32])
+	if err != nil || !bytes.Equal(r.Bytes(), e.sig[:32]) {
+		return parsedEntry{}, false
+	}
+	s, err := edwards25519.NewScalar().SetCanonicalBytes(e.sig[32:])
+	if err != nil {
+		return parsedEntry{}, false
+	}
+
+	h := sha512.New()
+	h.Write(e.sig[:32])
+	h.Write(e.pubKey)
+	h.Write(e.msg)
+	k, err := edwards25519.NewScalar().SetUniformBytes(h.Sum(nil))
+	if err != nil {
+		return parsedEntry{}, false
+	}
+	return parsedEntry{pubKey: pubKey, r: r, s: s, k: k}, true
+}
+
+// verifyBatch checks that the sum of z([s]B - R - [k]A) over all the entries,
+// each with a random z, is a point of small order. If any of the signatures is
+// invalid it is only by chance, with a probability of 2^-128.
+func verifyBatch(entries []batchEntry) bool {
+	if len(entries) < minBatchSignatures {
+		return verifyEach(entries)
+	}
+
+	var (
+		scalars = make([]*edwards25519.Scalar, 1, 1+2*len(entries))
+		points  = make([]*edwards25519.Point, 1, 1+2*len(entries))
+		sum     = edwards25519.NewScalar()
+	)
+	for _, e := range entries {
+		p, ok := parseEntry(e)
+		if !ok {
+			return false
+		}
+		z, err := randomScalar()
+		if err != nil {
+			return verifyEach(entries)
+		}
+		sum.MultiplyAdd(z, p.s, sum)
+		scalars = append(scalars, z, edwards25519.NewScalar().Multiply(z, p.k))
+		points = append(points, p.r, p.pubKey)
+	}
+	scalars[0] = sum.Negate(sum)
+	points[0] = edwards25519.NewGeneratorPoint()
+
+	check := new(edwards25519.Point).VarTimeMultiScalarMult(scalars, points)
+	return isSmallOrder(check)
+}
+
+// verifyEach checks the entries one by one, that [s]B - R - [k]A is a point
+// of small order.
+func verifyEach(entries []batchEntry) bool {
+	for _, e := range entries {
+		p, ok := parseEntry(e)
+		if !ok {
+			return false
+		}
+		minusA := new(edwards25519.Point).Negate(p.pubKey)
+		check := new(edwards25519.Point).VarTimeDoubleScalarBaseMult(p.k, minusA, p.s)
+		if !isSmallOrder(check.Subtract(check, p.r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSmallOrder(p *edwards25519.Point) bool {
+	return new(edwards25519.Point).MultByCofactor(p).Equal(edwards25519.NewIdentityPoint()) == 1
+}
+
+// randomScalar returns a random 128 bit scalar.
+func randomScalar() (*edwards25519.Scalar, error) {
+	var b [32]byte
+	if _, err := rand.Read(b[:16]); err != nil {
+		return nil, err
+	}
+	return edwards25519.NewScalar().SetCanonicalBytes(b[:])
+}
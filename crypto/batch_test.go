@@ -0,0 +1,115 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"testing"
+
+	"filippo.io/edwards25519"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newVerifier returns a batch verifier with n valid signatures.
+func newVerifier(workers, n int) *BatchVerifier {
+	v := NewBatchVerifier(workers)
+	for i := 0; i < n; i++ {
+		var (
+			privKey = GeneratePrivateKey()
+			msg     = []byte{byte(i), byte(i >> 8)}
+		)
+		v.Add(privKey.Public(), msg, privKey.Sign(msg))
+	}
+	return v
+}
+
+func TestBatchVerifier(t *testing.T) {
+	assert.True(t, NewBatchVerifier(0).Verify())
+
+	for _, n := range []int{1, minBatchSignatures, minParallelSignatures, 100} {
+		v := newVerifier(4, n)
+		assert.Equal(t, n, v.Len())
+		assert.True(t, v.Verify(), n)
+
+		// A single invalid signature fails all of them.
+		entry := &v.entries[n/2]
+		sig := entry.sig
+		entry.sig = GeneratePrivateKey().Sign(entry.msg).Bytes()
+		assert.False(t, v.Verify(), n)
+
+		// So does a non-canonical s.
+		entry.sig = append([]byte{}, sig...)
+		entry.sig[63] |= 0xf0
+		assert.False(t, v.Verify(), n)
+
+		// And a signature of another message.
+		entry.sig = sig
+		entry.msg = []byte("foo")
+		assert.False(t, v.Verify(), n)
+	}
+}
+
+func TestBatchVerifierSmallOrder(t *testing.T) {
+	var (
+		privKey = GeneratePrivateKey()
+		pubKey  = privKey.Public()
+		msg     = []byte("foo")
+		h       = sha512.Sum512(privKey.key.Seed())
+	)
+	a, err := edwards25519.NewScalar().SetBytesWithClamping(h[:32])
+	require.NoError(t, err)
+	r, err := randomScalar()
+	require.NoError(t, err)
+
+	// Sign with R plus the point of order 2, (0, -1).
+	minusOne := bytes.Repeat([]byte{0xff}, 32)
+	minusOne[0], minusOne[31] = 0xec, 0x7f
+	torsion, err := new(edwards25519.Point).SetBytes(minusOne)
+	require.NoError(t, err)
+	R := new(edwards25519.Point).ScalarBaseMult(r)
+	R.Add(R, torsion)
+
+	k := sha512.New()
+	k.Write(R.Bytes())
+	k.Write(pubKey.Bytes())
+	k.Write(msg)
+	s, err := edwards25519.NewScalar().SetUniformBytes(k.Sum(nil))
+	require.NoError(t, err)
+	s.MultiplyAdd(s, a, r)
+	sig := SignatureFromBytes(append(R.Bytes(), s.Bytes()...))
+
+	// ed25519.Verify rejects it, but it passes the cofactored equation,
+	// whether it is verified in a batch or on its own.
+	assert.False(t, sig.Verify(pubKey, msg))
+	for _, n := range []int{1, minBatchSignatures} {
+		v := newVerifier(1, n-1)
+		v.Add(pubKey, msg, sig)
+		assert.True(t, v.Verify(), n)
+	}
+}
+
+func benchmarkBatchVerifier(b *testing.B, workers int) {
+	v := newVerifier(workers, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !v.Verify() {
+			b.Fatal("invalid signature")
+		}
+	}
+}
+
+func BenchmarkVerifyOneByOne(b *testing.B) {
+	v := newVerifier(1, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, e := range v.entries {
+			if !ed25519.Verify(e.pubKey, e.msg, e.sig) {
+				b.Fatal("invalid signature")
+			}
+		}
+	}
+}
+
+func BenchmarkBatchVerifierSerial(b *testing.B)   { benchmarkBatchVerifier(b, 1) }
+func BenchmarkBatchVerifierParallel(b *testing.B) { benchmarkBatchVerifier(b, 0) }
@@ -0,0 +1,175 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The network prefixes of encoded addresses.
+const (
+	MainNetPrefix = "bv"
+	TestNetPrefix = "tbv"
+)
+
+var (
+	// ErrInvalidAddress is returned for malformed encoded addresses.
+	ErrInvalidAddress = errors.New("invalid address")
+	// ErrInvalidChecksum is returned for encoded addresses with a bad
+	// checksum, which usually means they were mistyped.
+	ErrInvalidChecksum = errors.New("invalid address checksum")
+	// ErrWrongNetwork is returned for encoded addresses of another network.
+	ErrWrongNetwork = errors.New("address of wrong network")
+)
+
+const (
+	bech32Charset     = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	bech32MaxLen      = 90
+	bech32ChecksumLen = 6
+)
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+// Encode returns the bech32 encoding of the address with the network prefix,
+// like bv1....
+func (a Address) Encode(prefix string) string {
+	return bech32Encode(prefix, convertBits(a.value, 8, 5, true))
+}
+
+// ParseAddress decodes the bech32 encoded address of the network with the
+// prefix.
+func ParseAddress(s, prefix string) (Address, error) {
+	hrp, data, err := bech32Decode(s)
+	if err != nil {
+		return Address{}, err
+	}
+	if hrp != prefix {
+		return Address{}, fmt.Errorf("%w: [%s] has prefix [%s], expected [%s]", ErrWrongNetwork, s, hrp, prefix)
+	}
+
+	b := convertBits(data, 5, 8, false)
+	if b == nil {
+		return Address{}, fmt.Errorf("%w: [%s] has invalid padding", ErrInvalidAddress, s)
+	}
+	if err := ValidateAddress(b); err != nil {
+		return Address{}, fmt.Errorf("[%s]: %w", s, err)
+	}
+	return Address{value: b}, nil
+}
+
+func bech32Encode(hrp string, data []byte) string {
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, d := range data {
+		sb.WriteByte(bech32Charset[d])
+	}
+	for _, d := range bech32Checksum(hrp, data) {
+		sb.WriteByte(bech32Charset[d])
+	}
+	return sb.String()
+}
+
+// bech32Decode returns the human readable part and the 5 bit groups of the
+// data part of the bech32 string, verifying its checksum.
+func bech32Decode(s string) (string, []byte, error) {
+	if len(s) > bech32MaxLen {
+		return "", nil, fmt.Errorf("%w: too long (%d)", ErrInvalidAddress, len(s))
+	}
+	lower := strings.ToLower(s)
+	if lower != s && strings.ToUpper(s) != s {
+		return "", nil, fmt.Errorf("%w: [%s] has mixed case", ErrInvalidAddress, s)
+	}
+
+	sep := strings.LastIndexByte(lower, '1')
+	if sep < 1 || sep+bech32ChecksumLen+1 > len(lower) {
+		return "", nil, fmt.Errorf("%w: [%s] has no valid separator", ErrInvalidAddress, s)
+	}
+
+	hrp := lower[:sep]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, fmt.Errorf("%w: [%s] has an invalid prefix", ErrInvalidAddress, s)
+		}
+	}
+
+	data := make([]byte, 0, len(lower)-sep-1)
+	for i := sep + 1; i < len(lower); i++ {
+		d := strings.IndexByte(bech32Charset, lower[i])
+		if d < 0 {
+			return "", nil, fmt.Errorf("%w: [%s] has invalid character [%c]", ErrInvalidAddress, s, s[i])
+		}
+		data = append(data, byte(d))
+	}
+
+	if bech32Polymod(append(bech32ExpandHRP(hrp), data...)) != 1 {
+		return "", nil, fmt.Errorf("%w: [%s]", ErrInvalidChecksum, s)
+	}
+	return hrp, data[:len(data)-bech32ChecksumLen], nil
+}
+
+func bech32Checksum(hrp string, data []byte) []byte {
+	values := append(bech32ExpandHRP(hrp), data...)
+	values = append(values, make([]byte, bech32ChecksumLen)...)
+	mod := bech32Polymod(values) ^ 1
+
+	checksum := make([]byte, bech32ChecksumLen)
+	for i := range checksum {
+		checksum[i] = byte(mod>>(5*(5-i))) & 31
+	}
+	return checksum
+}
+
+func bech32ExpandHRP(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i, g := range bech32Generator {
+			if (top>>i)&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+	return chk
+}
+
+// convertBits regroups the bits of data from groups of fromBits into groups
+// of toBits. It returns nil if the data can't be regrouped without padding
+// and pad is false.
+func convertBits(data []byte, fromBits, toBits uint, pad bool) []byte {
+	var (
+		acc    uint32
+		bits   uint
+		maxv   = uint32(1)<<toBits - 1
+		result = make([]byte, 0, len(data)*int(fromBits)/int(toBits)+1)
+	)
+	for _, d := range data {
+		acc = acc<<fromBits | uint32(d)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			result = append(result, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors of BIP-173.
+func TestBech32(t *testing.T) {
+	valid := []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+	}
+	for _, s := range valid {
+		hrp, data, err := bech32Decode(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, strings.ToLower(s), bech32Encode(hrp, data))
+	}
+
+	invalid := map[string]error{
+		"pzry9x0s0muk":  ErrInvalidAddress,
+		"1pzry9x0s0muk": ErrInvalidAddress,
+		"x1b4n0q5v":     ErrInvalidAddress,
+		"li1dgmt3":      ErrInvalidAddress,
+		"A1G7SGD8":      ErrInvalidChecksum,
+		"a12UEL5L":      ErrInvalidAddress,
+		"a12uel5m":      ErrInvalidChecksum,
+	}
+	for s, want := range invalid {
+		_, _, err := bech32Decode(s)
+		assert.ErrorIs(t, err, want, s)
+	}
+}
+
+func TestParseAddress(t *testing.T) {
+	address := GeneratePrivateKey().Public().Address()
+	encoded := address.Encode(MainNetPrefix)
+	assert.True(t, strings.HasPrefix(encoded, MainNetPrefix+"1"))
+
+	parsed, err := ParseAddress(encoded, MainNetPrefix)
+	require.NoError(t, err)
+	assert.Equal(t, address, parsed)
+
+	parsed, err = ParseAddress(strings.ToUpper(encoded), MainNetPrefix)
+	require.NoError(t, err)
+	assert.Equal(t, address, parsed)
+
+	_, err = ParseAddress(encoded, TestNetPrefix)
+	assert.ErrorIs(t, err, ErrWrongNetwork)
+
+	// A single mistyped character is caught by the checksum.
+	typo := []byte(encoded)
+	if typo[10] == 'q' {
+		typo[10] = 'p'
+	} else {
+		typo[10] = 'q'
+	}
+	_, err = ParseAddress(string(typo), MainNetPrefix)
+	assert.ErrorIs(t, err, ErrInvalidChecksum)
+
+	_, err = ParseAddress("not an address", MainNetPrefix)
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+
+	short := bech32Encode(MainNetPrefix, convertBits(address.Bytes()[:19], 8, 5, true))
+	_, err = ParseAddress(short, MainNetPrefix)
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+
+	// Legacy addresses can't be sent to anymore.
+	legacy := GeneratePrivateKey().Public().LegacyAddress().Encode(MainNetPrefix)
+	_, err = ParseAddress(legacy, MainNetPrefix)
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+}
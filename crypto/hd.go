@@ -0,0 +1,131 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HardenedOffset is added to the index of a hardened child key. Ed25519
+	// only supports hardened derivation.
+	HardenedOffset uint32 = 0x80000000
+	// CoinType is the BIP-44 coin type of the wallet key paths.
+	CoinType uint32 = 9000
+
+	minMasterSeedLen = 16
+	maxMasterSeedLen = 64
+)
+
+// ErrInvalidPath is returned for malformed derivation paths and paths with
+// non hardened indexes.
+var ErrInvalidPath = errors.New("invalid derivation path")
+
+// HDKey is an extended ed25519 private key of a SLIP-0010 key tree. All the
+// keys of the tree are derived from the master seed, so backing up the seed
+// backs up all of them.
+type HDKey struct {
+	seed      []byte
+	chainCode []byte
+}
+
+// NewMasterKey returns the root of the key tree of the master seed, which is
+// usually derived from a mnemonic, see MnemonicToSeed.
+func NewMasterKey(seed []byte) (*HDKey, error) {
+	if len(seed) < minMasterSeedLen || len(seed) > maxMasterSeedLen {
+		return nil, fmt.Errorf("invalid master seed length (%d)", len(seed))
+	}
+	return newHDKey([]byte("ed25519 seed"), seed), nil
+}
+
+func newHDKey(key, data []byte) *HDKey {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	return &HDKey{
+		seed:      sum[:SeedLen],
+		chainCode: sum[SeedLen:],
+	}
+}
+
+// Child derives the hardened child key at the index, which must include the
+// HardenedOffset.
+func (k *HDKey) Child(index uint32) (*HDKey, error) {
+	if index < HardenedOffset {
+		return nil, fmt.Errorf("%w: index (%d) is not hardened", ErrInvalidPath, index)
+	}
+
+	data := make([]byte, 0, 1+SeedLen+4)
+	data = append(data, 0)
+	data = append(data, k.seed...)
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	return newHDKey(k.chainCode, data), nil
+}
+
+// Derive derives the key at the path relative to this key, like "m/0'/1'".
+func (k *HDKey) Derive(path string) (*HDKey, error) {
+	indexes, err := ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := k
+	for _, index := range indexes {
+		if key, err = key.Child(index); err != nil {
+			return nil, err
+		}
+	}
+	return key, nil
+}
+
+// ChainCode returns the chain code of the key.
+func (k *HDKey) ChainCode() []byte {
+	return k.chainCode
+}
+
+// PrivateKey returns the signing key of the extended key.
+func (k *HDKey) PrivateKey() *PrivateKey {
+	return &PrivateKey{
+		key: ed25519.NewKeyFromSeed(k.seed),
+	}
+}
+
+// ParsePath parses a derivation path like "m/44'/9000'/0'" into the indexes
+// of the child keys. Every index has to be hardened, marked by ' or h.
+func ParsePath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("%w: [%s] doesn't start with m", ErrInvalidPath, path)
+	}
+
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		s, hardened := strings.CutSuffix(part, "'")
+		if !hardened {
+			s, hardened = strings.CutSuffix(part, "h")
+		}
+		if !hardened {
+			return nil, fmt.Errorf("%w: index [%s] of [%s] is not hardened", ErrInvalidPath, part, path)
+		}
+
+		index, err := strconv.ParseUint(s, 10, 32)
+		if err != nil || uint32(index) >= HardenedOffset {
+			return nil, fmt.Errorf("%w: invalid index [%s] of [%s]", ErrInvalidPath, part, path)
+		}
+		indexes = append(indexes, uint32(index)+HardenedOffset)
+	}
+	return indexes, nil
+}
+
+// WalletPath returns the BIP-44 path of the key at the index of the account,
+// m/44'/CoinType'/account'/0'/index'.
+func WalletPath(account, index uint32) string {
+	return fmt.Sprintf("m/44'/%d'/%d'/0'/%d'", CoinType, account, index)
+}
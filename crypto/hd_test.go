@@ -0,0 +1,66 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vector 1 for ed25519 of SLIP-0010.
+func TestDeriveSLIP10(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := NewMasterKey(seed)
+	require.NoError(t, err)
+
+	tests := []struct {
+		path      string
+		chainCode string
+		seed      string
+		pubKey    string
+	}{
+		{
+			path:      "m",
+			chainCode: "90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb",
+			seed:      "2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7",
+			pubKey:    "a4b2856bfec510abab89753fac1ac0e1112364e7d250545963f135f2a33188ed",
+		},
+		{
+			path:      "m/0'",
+			chainCode: "8b59aa11380b624e81507a27fedda59fea6d0b779a778918a2fd3590e16e9c69",
+			seed:      "68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3",
+			pubKey:    "8c8a13df77a28f3445213a0f432fde644acaa215fc72dcdf300d5efaa85d350c",
+		},
+		{
+			path:      "m/0h/1h",
+			chainCode: "a320425f77d1b5c2505a6b1b27382b37368ee640e3557c315416801243552f14",
+			seed:      "b1d0bad404bf35da785a64ca1ac54b2617211d2777696fbffaf208f746ae84f2",
+			pubKey:    "1932a5270f335bed617d5b935c80aedb1a35bd9fc1e31acafd5372c30f5c1187",
+		},
+	}
+	for _, test := range tests {
+		key, err := master.Derive(test.path)
+		require.NoError(t, err)
+		assert.Equal(t, test.chainCode, hex.EncodeToString(key.ChainCode()), test.path)
+		assert.Equal(t, test.seed, hex.EncodeToString(key.PrivateKey().key.Seed()), test.path)
+		assert.Equal(t, test.pubKey, hex.EncodeToString(key.PrivateKey().Public().Bytes()), test.path)
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	indexes, err := ParsePath(WalletPath(1, 2))
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{
+		44 + HardenedOffset,
+		CoinType + HardenedOffset,
+		1 + HardenedOffset,
+		HardenedOffset,
+		2 + HardenedOffset,
+	}, indexes)
+
+	for _, path := range []string{"", "0'", "m/0", "m/x'", "m/2147483648'", "m//0'"} {
+		_, err := ParsePath(path)
+		assert.ErrorIs(t, err, ErrInvalidPath, path)
+	}
+}
@@ -1,9 +1,13 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 )
 
@@ -11,31 +15,73 @@ const (
 	PrivKeyLen   = 64
 	PubKeyLen    = 32
 	SeedLen      = 32
-	AddressLen   = 20
 	SignatureLen = 64
+	// AddressLen is the length of an address, the AddressVersion followed by
+	// the truncated SHA256 hash of the public key.
+	AddressLen = 1 + addressHashLen
+	// LegacyAddressLen is the length of the addresses before versioning,
+	// which are the last bytes of the public key. Outputs locked to them
+	// remain spendable.
+	LegacyAddressLen = 20
+
+	// AddressVersion is the version byte of the addresses derived by
+	// PublicKey.Address.
+	AddressVersion byte = 1
+
+	addressHashLen = 20
+)
+
+var (
+	// ErrInvalidSeed is returned for private key seeds of the wrong length.
+	ErrInvalidSeed = errors.New("invalid private key seed")
+	// ErrInvalidPublicKey is returned for public keys of the wrong length.
+	ErrInvalidPublicKey = errors.New("invalid public key")
+	// ErrInvalidSignature is returned for signatures of the wrong length.
+	ErrInvalidSignature = errors.New("invalid signature")
 )
 
 type PrivateKey struct {
 	key ed25519.PrivateKey
 }
 
+// NewPrivateKeyFromString is like PrivateKeyFromString but panics on an
+// invalid seed.
 func NewPrivateKeyFromString(s string) *PrivateKey {
-	b, err := hex.DecodeString(s)
+	p, err := PrivateKeyFromString(s)
 	if err != nil {
 		panic(err)
 	}
-
-	return NewPrivateKeyFromSeed(b)
+	return p
 }
 
+// NewPrivateKeyFromSeed is like PrivateKeyFromSeed but panics on an invalid
+// seed.
 func NewPrivateKeyFromSeed(seed []byte) *PrivateKey {
+	p, err := PrivateKeyFromSeed(seed)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// PrivateKeyFromString returns the private key of the hex encoded seed.
+func PrivateKeyFromString(s string) (*PrivateKey, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSeed, err)
+	}
+	return PrivateKeyFromSeed(b)
+}
+
+// PrivateKeyFromSeed returns the private key of the seed.
+func PrivateKeyFromSeed(seed []byte) (*PrivateKey, error) {
 	if len(seed) != SeedLen {
-		panic("invalid seed length, must be 32")
+		return nil, fmt.Errorf("%w: length (%d) must be (%d)", ErrInvalidSeed, len(seed), SeedLen)
 	}
 
 	return &PrivateKey{
 		key: ed25519.NewKeyFromSeed(seed),
-	}
+	}, nil
 }
 
 func GeneratePrivateKey() *PrivateKey {
@@ -74,21 +120,58 @@ type PublicKey struct {
 	key ed25519.PublicKey
 }
 
+// PublicKeyFromBytes is like ParsePublicKey but panics on invalid bytes, so it
+// must not be used on bytes received from the network.
 func PublicKeyFromBytes(b []byte) *PublicKey {
+	p, err := ParsePublicKey(b)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// ParsePublicKey returns the public key of the bytes.
+func ParsePublicKey(b []byte) (*PublicKey, error) {
 	if len(b) != PubKeyLen {
-		panic("invalid public key length")
+		return nil, fmt.Errorf("%w: length (%d) must be (%d)", ErrInvalidPublicKey, len(b), PubKeyLen)
 	}
 	return &PublicKey{
 		key: ed25519.PublicKey(b),
-	}
+	}, nil
 }
 
+// Address returns the versioned address of the public key.
 func (p *PublicKey) Address() Address {
+	hash := sha256.Sum256(p.key)
+
+	b := make([]byte, 0, AddressLen)
+	b = append(b, AddressVersion)
+	b = append(b, hash[:addressHashLen]...)
+	return Address{
+		value: b,
+	}
+}
+
+// LegacyAddress returns the address the public key had before addresses were
+// versioned.
+func (p *PublicKey) LegacyAddress() Address {
 	return Address{
-		value: p.key[len(p.key)-AddressLen:],
+		value: p.key[len(p.key)-LegacyAddressLen:],
 	}
 }
 
+// Owns reports whether the address is the address or the legacy address of
+// the public key.
+func (p *PublicKey) Owns(address []byte) bool {
+	switch len(address) {
+	case AddressLen:
+		return bytes.Equal(p.Address().Bytes(), address)
+	case LegacyAddressLen:
+		return bytes.Equal(p.LegacyAddress().Bytes(), address)
+	}
+	return false
+}
+
 func (p *PublicKey) Bytes() []byte {
 	return p.key
 }
@@ -101,13 +184,24 @@ func (s *Signature) Bytes() []byte {
 	return s.value
 }
 
+// SignatureFromBytes is like ParseSignature but panics on invalid bytes, so it
+// must not be used on bytes received from the network.
 func SignatureFromBytes(b []byte) *Signature {
+	s, err := ParseSignature(b)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// ParseSignature returns the signature of the bytes.
+func ParseSignature(b []byte) (*Signature, error) {
 	if len(b) != SignatureLen {
-		panic("length of the bytes not equal to 64")
+		return nil, fmt.Errorf("%w: length (%d) must be (%d)", ErrInvalidSignature, len(b), SignatureLen)
 	}
 	return &Signature{
 		value: b,
-	}
+	}, nil
 }
 
 func (s *Signature) Verify(pubKey *PublicKey, msg []byte) bool {
@@ -118,6 +212,23 @@ type Address struct {
 	value []byte
 }
 
+// ValidateAddress checks that the bytes are an address of a known version.
+// Legacy addresses are rejected, coins can't be sent to them anymore.
+func ValidateAddress(b []byte) error {
+	switch {
+	case len(b) != AddressLen:
+		return fmt.Errorf("%w: invalid length (%d)", ErrInvalidAddress, len(b))
+	case b[0] != AddressVersion:
+		return fmt.Errorf("%w: unknown version (%d)", ErrInvalidAddress, b[0])
+	}
+	return nil
+}
+
+// IsLegacy reports whether the address is a legacy address.
+func (a Address) IsLegacy() bool {
+	return len(a.value) == LegacyAddressLen
+}
+
 func (a Address) Bytes() []byte {
 	return a.value
 }
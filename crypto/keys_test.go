@@ -19,11 +19,13 @@ func TestNewPrivateKeyFromString(t *testing.T) {
 	var (
 		seed       = "6c7d30d3bdfa3757bc0604463c2df006ee8f5cb997a8afa6e64c626ef64956da"
 		privKey    = NewPrivateKeyFromString(seed)
-		addressStr = "4e42b211628ca7e167c9e4f5fb1f24d032705e17"
+		addressStr = "0102d6f64a86ef5e940515998f7c93398add76a0da"
+		legacyStr  = "4e42b211628ca7e167c9e4f5fb1f24d032705e17"
 	)
 	assert.Equal(t, PrivKeyLen, len(privKey.Bytes()))
 	address := privKey.Public().Address()
 	assert.Equal(t, addressStr, address.String())
+	assert.Equal(t, legacyStr, privKey.Public().LegacyAddress().String())
 
 	// seed := make([]byte, 32)
 	// io.ReadFull(rand.Reader, seed)
@@ -54,5 +56,41 @@ func TestPublicKeyToAddress(t *testing.T) {
 	address := pubKey.Address()
 
 	assert.Equal(t, AddressLen, len(address.Bytes()))
+	assert.Equal(t, AddressVersion, address.Bytes()[0])
+	assert.NoError(t, ValidateAddress(address.Bytes()))
 	fmt.Println(address)
+
+	// The address is a hash of the public key and the legacy address a part
+	// of it; both are owned by the key.
+	assert.NotContains(t, string(pubKey.Bytes()), string(address.Bytes()[1:]))
+	assert.True(t, pubKey.Owns(address.Bytes()))
+	assert.True(t, pubKey.Owns(pubKey.LegacyAddress().Bytes()))
+	assert.True(t, pubKey.LegacyAddress().IsLegacy())
+	assert.False(t, GeneratePrivateKey().Public().Owns(address.Bytes()))
+
+	unknown := append([]byte{AddressVersion + 1}, address.Bytes()[1:]...)
+	assert.ErrorIs(t, ValidateAddress(unknown), ErrInvalidAddress)
+	assert.ErrorIs(t, ValidateAddress(pubKey.LegacyAddress().Bytes()), ErrInvalidAddress)
+	assert.False(t, pubKey.Owns(unknown))
+}
+
+func TestParseInvalidBytes(t *testing.T) {
+	_, err := PrivateKeyFromString("not hex")
+	assert.ErrorIs(t, err, ErrInvalidSeed)
+	_, err = PrivateKeyFromSeed(make([]byte, SeedLen-1))
+	assert.ErrorIs(t, err, ErrInvalidSeed)
+	_, err = ParsePublicKey(make([]byte, PubKeyLen+1))
+	assert.ErrorIs(t, err, ErrInvalidPublicKey)
+	_, err = ParseSignature(nil)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	assert.Panics(t, func() { PublicKeyFromBytes(nil) })
+
+	privKey, err := PrivateKeyFromSeed(make([]byte, SeedLen))
+	assert.NoError(t, err)
+	pubKey, err := ParsePublicKey(privKey.Public().Bytes())
+	assert.NoError(t, err)
+	sig, err := ParseSignature(privKey.Sign([]byte("foo")).Bytes())
+	assert.NoError(t, err)
+	assert.True(t, sig.Verify(pubKey, []byte("foo")))
 }
@@ -0,0 +1,194 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	keystoreVersion = 1
+	keystoreKDF     = "scrypt"
+	keystoreCipher  = "aes-256-gcm"
+	// maxScryptN, maxScryptMemory and maxScryptP bound the cost of
+	// decrypting a keystore file, which could otherwise be made arbitrarily
+	// expensive. Scrypt needs 128*r*N bytes of memory and its time grows
+	// with r*N*p.
+	maxScryptN      = 1 << 20
+	maxScryptMemory = 1 << 30
+	maxScryptP      = 16
+)
+
+// The scrypt costs of new keystore files. LightScryptN is much faster to
+// decrypt but also to brute force, so it should only be used for tests.
+const (
+	StandardScryptN = 1 << 18
+	LightScryptN    = 1 << 12
+)
+
+var (
+	// ErrWrongPassphrase is returned when decrypting a keystore with a wrong
+	// passphrase, or one that was tampered with.
+	ErrWrongPassphrase = errors.New("wrong keystore passphrase")
+	// ErrInvalidKeystore is returned for malformed keystore files.
+	ErrInvalidKeystore = errors.New("invalid keystore")
+)
+
+// keystore is the JSON encoding of a private key encrypted with a passphrase.
+// The seed of the key is encrypted with AES-GCM under a key derived from the
+// passphrase with scrypt, authenticating the address as well.
+type keystore struct {
+	Version int `json:"version"`
+	// Address is the encoding of the address of the key for the main
+	// network, which is the same key on every network. Older files have the
+	// hex encoded address, only the string is authenticated, so they still
+	// decrypt.
+	Address string `json:"address"`
+	Crypto  struct {
+		KDF       string       `json:"kdf"`
+		KDFParams scryptParams `json:"kdfparams"`
+		Cipher    string       `json:"cipher"`
+		Nonce     string       `json:"nonce"`
+		// Ciphertext is the encrypted seed followed by the GCM tag.
+		Ciphertext string `json:"ciphertext"`
+	} `json:"crypto"`
+}
+
+type scryptParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt string `json:"salt"`
+}
+
+// EncryptKey encrypts the private key with the passphrase into the JSON
+// keystore format, using scrypt with the cost scryptN.
+func EncryptKey(p *PrivateKey, passphrase string, scryptN int) ([]byte, error) {
+	var (
+		salt  = make([]byte, 32)
+		nonce = make([]byte, 12)
+	)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	ks := &keystore{
+		Version: keystoreVersion,
+		Address: p.Public().Address().Encode(MainNetPrefix),
+	}
+	ks.Crypto.KDF = keystoreKDF
+	ks.Crypto.KDFParams = scryptParams{N: scryptN, R: 8, P: 1, Salt: hex.EncodeToString(salt)}
+	ks.Crypto.Cipher = keystoreCipher
+	ks.Crypto.Nonce = hex.EncodeToString(nonce)
+
+	aead, err := ks.aead(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := aead.Seal(nil, nonce, p.key.Seed(), []byte(ks.Address))
+	ks.Crypto.Ciphertext = hex.EncodeToString(ciphertext)
+
+	return json.MarshalIndent(ks, "", "  ")
+}
+
+// DecryptKey decrypts the private key of the JSON keystore with the
+// passphrase.
+func DecryptKey(b []byte, passphrase string) (*PrivateKey, error) {
+	ks := &keystore{}
+	if err := json.Unmarshal(b, ks); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeystore, err)
+	}
+	if ks.Version != keystoreVersion {
+		return nil, fmt.Errorf("%w: unsupported version (%d)", ErrInvalidKeystore, ks.Version)
+	}
+	if ks.Crypto.KDF != keystoreKDF || ks.Crypto.Cipher != keystoreCipher {
+		return nil, fmt.Errorf("%w: unsupported kdf [%s] or cipher [%s]", ErrInvalidKeystore, ks.Crypto.KDF, ks.Crypto.Cipher)
+	}
+
+	salt, err := hex.DecodeString(ks.Crypto.KDFParams.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid salt", ErrInvalidKeystore)
+	}
+	nonce, err := hex.DecodeString(ks.Crypto.Nonce)
+	if err != nil || len(nonce) != 12 {
+		return nil, fmt.Errorf("%w: invalid nonce", ErrInvalidKeystore)
+	}
+	ciphertext, err := hex.DecodeString(ks.Crypto.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid ciphertext", ErrInvalidKeystore)
+	}
+
+	aead, err := ks.aead(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := aead.Open(nil, nonce, ciphertext, []byte(ks.Address))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	if len(seed) != SeedLen {
+		return nil, fmt.Errorf("%w: invalid seed length (%d)", ErrInvalidKeystore, len(seed))
+	}
+
+	return &PrivateKey{
+		key: ed25519.NewKeyFromSeed(seed),
+	}, nil
+}
+
+// aead derives the encryption key from the passphrase with the scrypt
+// parameters of the keystore.
+func (ks *keystore) aead(passphrase string, salt []byte) (cipher.AEAD, error) {
+	params := ks.Crypto.KDFParams
+	if params.N <= 1 || params.N > maxScryptN || params.N&(params.N-1) != 0 {
+		return nil, fmt.Errorf("%w: invalid scrypt n (%d)", ErrInvalidKeystore, params.N)
+	}
+	if params.R <= 0 || params.R > maxScryptMemory/(128*params.N) || params.P <= 0 || params.P > maxScryptP {
+		return nil, fmt.Errorf("%w: invalid scrypt r (%d) or p (%d)", ErrInvalidKeystore, params.R, params.P)
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKeystore, err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SaveKeystore encrypts the private key with the passphrase and writes it to
+// the file, which is only readable by the owner.
+func SaveKeystore(path string, p *PrivateKey, passphrase string, scryptN int) error {
+	b, err := EncryptKey(p, passphrase, scryptN)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+// LoadKeystore reads the keystore file and decrypts its private key with the
+// passphrase.
+func LoadKeystore(path, passphrase string) (*PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := DecryptKey(b, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("keystore %s: %w", path, err)
+	}
+	return p, nil
+}
@@ -0,0 +1,76 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeystore(t *testing.T) {
+	privKey := GeneratePrivateKey()
+
+	b, err := EncryptKey(privKey, "passphrase", LightScryptN)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), hex.EncodeToString(privKey.key.Seed()))
+
+	decrypted, err := DecryptKey(b, "passphrase")
+	require.NoError(t, err)
+	assert.Equal(t, privKey.Bytes(), decrypted.Bytes())
+
+	_, err = DecryptKey(b, "wrong")
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+
+	// The address is authenticated.
+	ks := map[string]any{}
+	require.NoError(t, json.Unmarshal(b, &ks))
+	assert.Equal(t, privKey.Public().Address().Encode(MainNetPrefix), ks["address"])
+	ks["address"] = GeneratePrivateKey().Public().Address().Encode(MainNetPrefix)
+	tampered, err := json.Marshal(ks)
+	require.NoError(t, err)
+	_, err = DecryptKey(tampered, "passphrase")
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+
+	_, err = DecryptKey([]byte("{}"), "passphrase")
+	assert.ErrorIs(t, err, ErrInvalidKeystore)
+}
+
+func TestKeystoreRejectsExpensiveParams(t *testing.T) {
+	b, err := EncryptKey(GeneratePrivateKey(), "passphrase", LightScryptN)
+	require.NoError(t, err)
+
+	for _, params := range []scryptParams{
+		{N: 1 << 30, R: 8, P: 1},
+		{N: LightScryptN, R: 268435455, P: 1},
+		{N: maxScryptN, R: 9, P: 1},
+		{N: LightScryptN, R: 8, P: 1 << 20},
+	} {
+		ks := &keystore{}
+		require.NoError(t, json.Unmarshal(b, ks))
+		params.Salt = ks.Crypto.KDFParams.Salt
+		ks.Crypto.KDFParams = params
+		encoded, err := json.Marshal(ks)
+		require.NoError(t, err)
+
+		_, err = DecryptKey(encoded, "passphrase")
+		assert.ErrorIs(t, err, ErrInvalidKeystore, params)
+	}
+}
+
+func TestSaveLoadKeystore(t *testing.T) {
+	var (
+		privKey = GeneratePrivateKey()
+		path    = filepath.Join(t.TempDir(), "key.json")
+	)
+	require.NoError(t, SaveKeystore(path, privKey, "passphrase", LightScryptN))
+
+	loaded, err := LoadKeystore(path, "passphrase")
+	require.NoError(t, err)
+	assert.Equal(t, privKey.Public().Bytes(), loaded.Public().Bytes())
+
+	_, err = LoadKeystore(path, "wrong")
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+}
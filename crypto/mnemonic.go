@@ -0,0 +1,133 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MnemonicEntropyLen is the entropy of generated mnemonics, which encode it
+// in 24 words.
+const MnemonicEntropyLen = 32
+
+// ErrInvalidMnemonic is returned for mnemonics with unknown words, a wrong
+// number of words or a bad checksum.
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+// english is the BIP-39 English wordlist.
+//
+//go:embed wordlist/english.txt
+var english string
+
+var (
+	wordlist  = strings.Fields(english)
+	wordIndex = func() map[string]int {
+		index := make(map[string]int, len(wordlist))
+		for i, word := range wordlist {
+			index[word] = i
+		}
+		return index
+	}()
+)
+
+// GenerateMnemonic returns a BIP-39 mnemonic of new random entropy.
+func GenerateMnemonic() string {
+	entropy := make([]byte, MnemonicEntropyLen)
+
+	_, err := io.ReadFull(rand.Reader, entropy)
+	if err != nil {
+		panic(err)
+	}
+
+	mnemonic, _ := NewMnemonic(entropy)
+	return mnemonic
+}
+
+// NewMnemonic encodes the entropy, a multiple of 4 bytes between 16 and 32
+// bytes, as a BIP-39 mnemonic. Every word encodes 11 bits of the entropy
+// followed by the first bits of its SHA256 hash as a checksum.
+func NewMnemonic(entropy []byte) (string, error) {
+	if len(entropy) < 16 || len(entropy) > 32 || len(entropy)%4 != 0 {
+		return "", fmt.Errorf("invalid mnemonic entropy length (%d)", len(entropy))
+	}
+
+	var (
+		hash     = sha256.Sum256(entropy)
+		bits     = append(append([]byte{}, entropy...), hash[0])
+		numWords = (len(entropy)*8 + len(entropy)/4) / 11
+		words    = make([]string, numWords)
+	)
+	for i := range words {
+		words[i] = wordlist[readBits(bits, i*11, 11)]
+	}
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToEntropy decodes the mnemonic and verifies its checksum.
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(norm.NFKD.String(mnemonic))
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, fmt.Errorf("%w: invalid number of words (%d)", ErrInvalidMnemonic, len(words))
+	}
+
+	var (
+		checksumBits = len(words) / 3
+		entropyLen   = (len(words)*11 - checksumBits) / 8
+		bits         = make([]byte, entropyLen+1)
+	)
+	for i, word := range words {
+		index, ok := wordIndex[word]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown word [%s]", ErrInvalidMnemonic, word)
+		}
+		writeBits(bits, i*11, 11, index)
+	}
+
+	entropy := bits[:entropyLen]
+	hash := sha256.Sum256(entropy)
+	if readBits(bits, entropyLen*8, checksumBits) != readBits(hash[:], 0, checksumBits) {
+		return nil, fmt.Errorf("%w: bad checksum", ErrInvalidMnemonic)
+	}
+	return entropy, nil
+}
+
+// MnemonicToSeed verifies the mnemonic and derives the 64 byte master seed of
+// it and the optional passphrase, see NewMasterKey.
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	if _, err := MnemonicToEntropy(mnemonic); err != nil {
+		return nil, err
+	}
+
+	var (
+		password = strings.Join(strings.Fields(norm.NFKD.String(mnemonic)), " ")
+		salt     = "mnemonic" + norm.NFKD.String(passphrase)
+	)
+	return pbkdf2.Key([]byte(password), []byte(salt), 2048, 64, sha512.New), nil
+}
+
+// readBits returns n bits of b starting at bit offset, most significant first.
+func readBits(b []byte, offset, n int) int {
+	var v int
+	for i := offset; i < offset+n; i++ {
+		v = v<<1 | int(b[i/8]>>(7-i%8)&1)
+	}
+	return v
+}
+
+// writeBits writes the n lowest bits of v into b starting at bit offset.
+func writeBits(b []byte, offset, n, v int) {
+	for i := 0; i < n; i++ {
+		if v>>(n-1-i)&1 == 1 {
+			pos := offset + i
+			b[pos/8] |= 1 << (7 - pos%8)
+		}
+	}
+}
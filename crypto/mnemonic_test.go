@@ -0,0 +1,63 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test vectors of BIP-39, using the passphrase TREZOR.
+func TestMnemonic(t *testing.T) {
+	tests := []struct {
+		entropy  string
+		mnemonic string
+		seed     string
+	}{
+		{
+			entropy:  "00000000000000000000000000000000",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			seed:     "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			entropy:  "7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			mnemonic: "legal winner thank year wave sausage worth useful legal winner thank yellow",
+			seed:     "2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+	}
+	for _, test := range tests {
+		entropy, _ := hex.DecodeString(test.entropy)
+		mnemonic, err := NewMnemonic(entropy)
+		require.NoError(t, err)
+		assert.Equal(t, test.mnemonic, mnemonic)
+
+		decoded, err := MnemonicToEntropy(mnemonic)
+		require.NoError(t, err)
+		assert.Equal(t, entropy, decoded)
+
+		seed, err := MnemonicToSeed(mnemonic, "TREZOR")
+		require.NoError(t, err)
+		assert.Equal(t, test.seed, hex.EncodeToString(seed))
+	}
+}
+
+func TestInvalidMnemonic(t *testing.T) {
+	mnemonic := GenerateMnemonic()
+	words := strings.Fields(mnemonic)
+	assert.Len(t, words, 24)
+
+	_, err := MnemonicToEntropy(mnemonic)
+	require.NoError(t, err)
+
+	invalid := []string{
+		strings.Join(words[:23], " "),
+		strings.Join(append(words[:23:23], "notaword"), " "),
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+	}
+	for _, m := range invalid {
+		_, err := MnemonicToSeed(m, "")
+		assert.ErrorIs(t, err, ErrInvalidMnemonic, m)
+	}
+}
@@ -2,22 +2,25 @@ module github.com/vlayco/blockverse
 
 go 1.22.1
 
-require github.com/stretchr/testify v1.9.0
+require (
+	filippo.io/edwards25519 v1.1.0
+	github.com/stretchr/testify v1.9.0
+	go.uber.org/zap v1.27.0
+	golang.org/x/crypto v0.21.0
+	golang.org/x/text v0.14.0
+)
 
 require (
 	go.uber.org/multierr v1.11.0 // indirect
-	go.uber.org/zap v1.27.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
-	golang.org/x/sys v0.17.0 // indirect
-	golang.org/x/text v0.14.0 // indirect
+	golang.org/x/sys v0.18.0 // indirect
 	google.golang.org/genproto/googleapis/rpc v0.0.0-20240227224415-6ceb2ff114de // indirect
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/google/protobuf v5.26.1+incompatible // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	google.golang.org/grpc v1.63.2
-	google.golang.org/protobuf v1.33.0 // indirect
+	google.golang.org/protobuf v1.33.0
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
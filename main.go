@@ -2,36 +2,41 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
 	"github.com/vlayco/blockverse/crypto"
 	"github.com/vlayco/blockverse/node"
 	"github.com/vlayco/blockverse/proto"
-	"github.com/vlayco/blockverse/util"
+	"github.com/vlayco/blockverse/wallet"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
-	makeNode(":3000", []string{}, true)
+	validator := makeNode(":3000", []string{}, true)
 	time.Sleep(time.Second * 1)
 	makeNode(":4000", []string{":3000"}, false)
 	time.Sleep(time.Second * 2)
 	makeNode(":5000", []string{":4000"}, false)
 
-	// go func() {
-	// 	for {
-	// 		makeTransaction()
-	// 	}
-	// }()
+	client, err := grpc.Dial(":3000", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatal(err)
+	}
+	c := proto.NewNodeClient(client)
 
-	// log.Fatal(node.Start(":3000"))
+	// The dev key is funded by the default genesis.
+	w := wallet.New(crypto.NewPrivateKeyFromString(node.DevSeed))
 	for {
 		time.Sleep(time.Millisecond * 100)
-		makeTransaction()
+		if err := w.Sync(validator.Chain()); err != nil {
+			log.Println(err)
+			continue
+		}
+		makeTransaction(c, w)
 	}
-	// select {}
 }
 
 func makeNode(listenAddr string, bootstrapNodes []string, isValidator bool) *node.Node {
@@ -40,45 +45,38 @@ func makeNode(listenAddr string, bootstrapNodes []string, isValidator bool) *nod
 		ListenAddr: listenAddr,
 	}
 
+	// The default genesis has the dev key as its only validator.
 	if isValidator {
-		cfg.PrivateKey = crypto.GeneratePrivateKey()
+		cfg.PrivateKey = crypto.NewPrivateKeyFromString(node.DevSeed)
 	}
 
-	n := node.NewNode(cfg)
+	n, err := node.NewNode(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
 	go n.Start(listenAddr, bootstrapNodes)
 
 	return n
 }
 
 // just for testing
-func makeTransaction() {
-	client, err := grpc.Dial(":3000", grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Fatal(err)
+func makeTransaction(c proto.NodeClient, w *wallet.Wallet) {
+	to := w.EncodeAddress(crypto.GeneratePrivateKey().Public().Address())
+	tx, err := w.CreateTransaction(to, 5, 1)
+	// The change of the pending payment can only be spent once it is part of
+	// a block.
+	if errors.Is(err, wallet.ErrInsufficientFunds) {
+		return
 	}
-
-	c := proto.NewNodeClient(client)
-
-	privKey := crypto.GeneratePrivateKey()
-	tx := &proto.Transaction{
-		Version: 1,
-		Inputs: []*proto.TxInput{
-			{
-				PrevTxHash:   util.RandomHash(),
-				PrevOutIndex: 0,
-				PublicKey:    privKey.Public().Bytes(),
-			},
-		},
-		Outputs: []*proto.TxOutput{
-			{
-				Amount:  99,
-				Address: privKey.Public().Address().Bytes(),
-			},
-		},
+	if err != nil {
+		log.Println(err)
+		return
 	}
+	log.Printf("sending 5 to %s", to)
 
 	_, err = c.HandleTransaction(context.Background(), tx)
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
+		w.Release(tx)
 	}
 }
@@ -0,0 +1,140 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+)
+
+// Leaves and inner nodes are hashed with a different prefix, so an inner node
+// can never be passed off as a leaf.
+const (
+	leafPrefix = 0x00
+	nodePrefix = 0x01
+)
+
+// Tree is a binary Merkle tree. A node without a sibling is promoted to the
+// next level as is, instead of being paired with itself.
+type Tree struct {
+	// levels[0] holds the hashes of the leaves and the last level the root.
+	levels [][][]byte
+}
+
+// NewTree builds the tree over the given leaves.
+func NewTree(leaves [][]byte) *Tree {
+	level := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = hashLeaf(leaf)
+	}
+
+	t := &Tree{
+		levels: [][][]byte{level},
+	}
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, hashNode(level[i], level[i+1]))
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+
+	return t
+}
+
+// Root returns the root hash of the tree. The root of an empty tree is the
+// hash of no data.
+func (t *Tree) Root() []byte {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		hash := sha256.Sum256(nil)
+		return hash[:]
+	}
+	return top[0]
+}
+
+// Proof is an inclusion proof of a leaf in a tree.
+type Proof struct {
+	// Index is the position of the leaf.
+	Index int
+	// LeafCount is the number of leaves in the tree.
+	LeafCount int
+	// Hashes are the sibling hashes on the path from the leaf to the root.
+	Hashes [][]byte
+}
+
+// Proof returns the inclusion proof of the leaf at the given index.
+func (t *Tree) Proof(index int) (*Proof, error) {
+	leafCount := len(t.levels[0])
+	if index < 0 || index >= leafCount {
+		return nil, fmt.Errorf("leaf index (%d) out of range - leaves (%d)", index, leafCount)
+	}
+
+	proof := &Proof{
+		Index:     index,
+		LeafCount: leafCount,
+	}
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof.Hashes = append(proof.Hashes, level[sibling])
+		}
+		index /= 2
+	}
+
+	return proof, nil
+}
+
+// VerifyProof reports whether the proof shows that leaf is part of the tree
+// with the given root.
+func VerifyProof(root, leaf []byte, proof *Proof) bool {
+	if proof == nil || proof.Index < 0 || proof.Index >= proof.LeafCount {
+		return false
+	}
+
+	var (
+		hash   = hashLeaf(leaf)
+		index  = proof.Index
+		size   = proof.LeafCount
+		hashes = proof.Hashes
+	)
+	for size > 1 {
+		switch {
+		case index%2 == 1:
+			if len(hashes) == 0 {
+				return false
+			}
+			hash = hashNode(hashes[0], hash)
+			hashes = hashes[1:]
+		case index+1 < size:
+			if len(hashes) == 0 {
+				return false
+			}
+			hash = hashNode(hash, hashes[0])
+			hashes = hashes[1:]
+		}
+		index /= 2
+		size = (size + 1) / 2
+	}
+
+	return len(hashes) == 0 && bytes.Equal(hash, root)
+}
+
+func hashLeaf(leaf []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(leaf)
+	return h.Sum(nil)
+}
+
+func hashNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{nodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
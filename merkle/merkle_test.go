@@ -0,0 +1,63 @@
+package merkle
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeLeaves(n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		leaves[i] = []byte(fmt.Sprintf("leaf-%d", i))
+	}
+	return leaves
+}
+
+func TestRoot(t *testing.T) {
+	assert.Equal(t, 32, len(NewTree(nil).Root()))
+
+	leaves := makeLeaves(5)
+	root := NewTree(leaves).Root()
+	assert.Equal(t, 32, len(root))
+	assert.Equal(t, root, NewTree(makeLeaves(5)).Root())
+
+	// Changing, dropping or reordering leaves changes the root.
+	assert.NotEqual(t, root, NewTree(makeLeaves(4)).Root())
+	leaves[0], leaves[1] = leaves[1], leaves[0]
+	assert.NotEqual(t, root, NewTree(leaves).Root())
+
+	// A single leaf is not its own root.
+	assert.NotEqual(t, []byte("leaf-0"), NewTree(makeLeaves(1)).Root())
+}
+
+func TestProof(t *testing.T) {
+	for n := 1; n <= 17; n++ {
+		var (
+			leaves = makeLeaves(n)
+			tree   = NewTree(leaves)
+			root   = tree.Root()
+		)
+		for i, leaf := range leaves {
+			proof, err := tree.Proof(i)
+			require.NoError(t, err)
+			assert.True(t, VerifyProof(root, leaf, proof), "leaves %d index %d", n, i)
+
+			// The proof does not hold for another leaf or position.
+			assert.False(t, VerifyProof(root, []byte("foo"), proof))
+			if n > 1 {
+				proof.Index = (i + 1) % n
+				assert.False(t, VerifyProof(root, leaf, proof))
+			}
+		}
+	}
+
+	tree := NewTree(makeLeaves(3))
+	_, err := tree.Proof(3)
+	assert.Error(t, err)
+	_, err = tree.Proof(-1)
+	assert.Error(t, err)
+	assert.False(t, VerifyProof(tree.Root(), []byte("leaf-0"), nil))
+}
@@ -0,0 +1,161 @@
+package node
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+
+	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/proto"
+)
+
+// Account is the state of an account used by account transactions, which
+// exist alongside the outputs of the UTXO set.
+type Account struct {
+	Balance int64
+	// Nonce is the number of transactions sent from the account, which is
+	// the nonce its next transaction has to use.
+	Nonce uint64
+}
+
+// Account returns the state of the account with the given address on the main
+// chain. Unknown accounts are empty.
+func (c *Chain) Account(address []byte) Account {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.account(hex.EncodeToString(address), nil)
+}
+
+// account returns the state of the account with the given hex encoded address,
+// including the changes of the block state if any.
+func (c *Chain) account(address string, state *blockState) Account {
+	if state != nil {
+		if acc, ok := state.accounts[address]; ok {
+			return *acc
+		}
+	}
+	if acc, ok := c.accounts[address]; ok {
+		return *acc
+	}
+	return Account{}
+}
+
+// validateAccountTransaction checks the nonce of the account transaction and
+// that the sender can pay for it, and applies it to the block state if it is
+// valid. It returns the fee of the transaction.
+func (c *Chain) validateAccountTransaction(tx *proto.Transaction, state *blockState) (int64, error) {
+	acc := tx.Account
+	from, err := accountAddress(acc)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrInvalidTransaction, err)
+	}
+
+	var (
+		to     = hex.EncodeToString(acc.To)
+		sender = c.account(from, state)
+	)
+	if acc.Nonce != sender.Nonce {
+		return 0, fmt.Errorf("%w: nonce (%d) of account [%s] - expected (%d)", ErrInvalidNonce, acc.Nonce, from, sender.Nonce)
+	}
+	if acc.Amount > math.MaxInt64-acc.Fee {
+		return 0, fmt.Errorf("%w: amount plus fee overflows", ErrInvalidTransaction)
+	}
+	if sender.Balance < acc.Amount+acc.Fee {
+		return 0, fmt.Errorf("%w: account [%s] has (%d) - needs (%d)", ErrInsufficientBalance, from, sender.Balance, acc.Amount+acc.Fee)
+	}
+
+	sender.Balance -= acc.Amount + acc.Fee
+	sender.Nonce++
+
+	recipient := c.account(to, state)
+	if to == from {
+		recipient = sender
+	}
+	if recipient.Balance > math.MaxInt64-acc.Amount {
+		return 0, fmt.Errorf("%w: balance of account [%s] overflows", ErrInvalidTransaction, to)
+	}
+	recipient.Balance += acc.Amount
+
+	state.accounts[from] = &sender
+	state.accounts[to] = &recipient
+
+	return acc.Fee, nil
+}
+
+// validateAccountStructure checks the parts of the account transaction that
+// don't depend on the state of the chain.
+func validateAccountStructure(tx *proto.Transaction) error {
+	if len(tx.Inputs) != 0 || len(tx.Outputs) != 0 {
+		return fmt.Errorf("%w: account transaction with inputs or outputs", ErrInvalidTransaction)
+	}
+
+	acc := tx.Account
+	if len(acc.From) != crypto.PubKeyLen {
+		return fmt.Errorf("%w: invalid sender public key length (%d)", ErrInvalidTransaction, len(acc.From))
+	}
+	// Accounts are only known by their versioned address.
+	if len(acc.To) != crypto.AddressLen || crypto.ValidateAddress(acc.To) != nil {
+		return fmt.Errorf("%w: invalid recipient address [%x]", ErrInvalidTransaction, acc.To)
+	}
+	if acc.Amount < 0 || acc.Fee < 0 {
+		return fmt.Errorf("%w: negative amount (%d) or fee (%d)", ErrInvalidTransaction, acc.Amount, acc.Fee)
+	}
+	return nil
+}
+
+// applyAccountTransaction moves the coins of the account transaction from the
+// sender with the hex encoded address and bumps its nonce. It has been
+// validated before.
+func (c *Chain) applyAccountTransaction(from string, acc *proto.AccountTx) {
+	sender := c.mutableAccount(from)
+	sender.Balance -= acc.Amount + acc.Fee
+	sender.Nonce++
+
+	recipient := c.mutableAccount(hex.EncodeToString(acc.To))
+	recipient.Balance += acc.Amount
+}
+
+// revertAccountTransaction undoes applyAccountTransaction.
+func (c *Chain) revertAccountTransaction(acc *proto.AccountTx) error {
+	from, err := accountAddress(acc)
+	if err != nil {
+		return err
+	}
+
+	to := hex.EncodeToString(acc.To)
+	recipient := c.mutableAccount(to)
+	recipient.Balance -= acc.Amount
+	c.pruneAccount(to)
+
+	sender := c.mutableAccount(from)
+	sender.Balance += acc.Amount + acc.Fee
+	sender.Nonce--
+	c.pruneAccount(from)
+	return nil
+}
+
+func (c *Chain) mutableAccount(address string) *Account {
+	acc, ok := c.accounts[address]
+	if !ok {
+		acc = &Account{}
+		c.accounts[address] = acc
+	}
+	return acc
+}
+
+// pruneAccount forgets the account if it is empty again.
+func (c *Chain) pruneAccount(address string) {
+	if acc, ok := c.accounts[address]; ok && *acc == (Account{}) {
+		delete(c.accounts, address)
+	}
+}
+
+// accountAddress returns the hex encoded address of the sender of the account
+// transaction.
+func accountAddress(acc *proto.AccountTx) (string, error) {
+	pubKey, err := crypto.ParsePublicKey(acc.From)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(pubKey.Address().Bytes()), nil
+}
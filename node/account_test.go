@@ -0,0 +1,100 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/types"
+)
+
+func accountTx(from *crypto.PrivateKey, to []byte, amount, fee int64, nonce uint64) *proto.Transaction {
+	tx := types.NewAccountTransaction(from.Public(), to, amount, fee, nonce)
+	signTransaction(from, tx)
+	return tx
+}
+
+func TestAccountTransaction(t *testing.T) {
+	var (
+		chain     = newChain(t)
+		devKey    = validatorKey()
+		dev       = devKey.Public().Address().Bytes()
+		recipient = crypto.GeneratePrivateKey()
+		to        = recipient.Public().Address().Bytes()
+	)
+	assert.Equal(t, Account{Balance: 1_000_000}, chain.Account(dev))
+	assert.Equal(t, Account{}, chain.Account(to))
+
+	// Nonces have to be used in order.
+	assert.ErrorIs(t, chain.ValidateTransaction(accountTx(devKey, to, 100, 1, 1)), ErrInvalidNonce)
+	assert.ErrorIs(t, chain.ValidateTransaction(accountTx(devKey, to, 1_000_000, 1, 0)), ErrInsufficientBalance)
+
+	// Only the sender can sign.
+	forged := types.NewAccountTransaction(devKey.Public(), to, 100, 1, 0)
+	forged.Account.Signature = recipient.Sign(types.SigHash(forged)).Bytes()
+	assert.ErrorIs(t, chain.ValidateTransaction(forged), ErrInvalidTransaction)
+
+	// Consecutive nonces can be used within the same block.
+	tx1 := accountTx(devKey, to, 100, 1, 0)
+	tx2 := accountTx(devKey, to, 50, 2, 1)
+	assert.NoError(t, chain.ValidateTransaction(tx1))
+
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+	b1 := childBlock(t, genesis, tx1, tx2)
+	b1.Transactions[0] = coinbase(1, 3)
+	b1.Header.RootHash = types.CalculateRootHash(b1.Transactions)
+	types.SignBlock(devKey, b1)
+	require.NoError(t, chain.AddBlock(b1))
+
+	assert.Equal(t, Account{Balance: 1_000_000 - 153, Nonce: 2}, chain.Account(dev))
+	assert.Equal(t, Account{Balance: 150}, chain.Account(to))
+
+	// The transactions can't be replayed.
+	assert.ErrorIs(t, chain.ValidateTransaction(tx1), ErrInvalidNonce)
+	assert.Error(t, chain.AddBlock(childBlock(t, b1, tx1)))
+
+	// The recipient can spend its balance.
+	assert.NoError(t, chain.ValidateTransaction(accountTx(recipient, dev, 150, 0, 0)))
+	assert.ErrorIs(t, chain.ValidateTransaction(accountTx(recipient, dev, 150, 1, 0)), ErrInsufficientBalance)
+
+	// A reorg undoes the transactions.
+	c1 := childBlock(t, genesis)
+	require.NoError(t, chain.AddBlock(c1))
+	require.NoError(t, chain.AddBlock(childBlock(t, c1)))
+	assert.Equal(t, Account{Balance: 1_000_000}, chain.Account(dev))
+	assert.Equal(t, Account{}, chain.Account(to))
+	assert.NoError(t, chain.ValidateTransaction(tx1))
+}
+
+func TestMemPoolAccountNonceConflict(t *testing.T) {
+	var (
+		pool = NewMemPool(DefaultMemPoolConfig())
+		key  = crypto.GeneratePrivateKey()
+		to   = crypto.GeneratePrivateKey().Public().Address().Bytes()
+	)
+
+	assert.NoError(t, pool.Add(accountTx(key, to, 10, 1, 0), 1))
+	assert.ErrorIs(t, pool.Add(accountTx(key, to, 20, 1, 0), 1), ErrTxConflict)
+	assert.NoError(t, pool.Add(accountTx(key, to, 20, 1, 1), 1))
+}
+
+func TestMemPoolPendingNonceOrder(t *testing.T) {
+	var (
+		pool = NewMemPool(DefaultMemPoolConfig())
+		key  = crypto.GeneratePrivateKey()
+		to   = crypto.GeneratePrivateKey().Public().Address().Bytes()
+		tx0  = accountTx(key, to, 10, 1, 0)
+		tx1  = accountTx(key, to, 10, 1, 1)
+	)
+
+	// The second transaction pays a higher fee, but it can only follow the
+	// first one.
+	require.NoError(t, pool.Add(tx1, 100))
+	require.NoError(t, pool.Add(tx0, 1))
+	assert.Equal(t, []*proto.Transaction{tx0, tx1}, pool.Pending(2))
+	assert.Equal(t, []*proto.Transaction{tx0}, pool.Pending(1))
+	assert.Equal(t, []*proto.Transaction{tx0, tx1}, pool.AccountTransactions(key.Public().Bytes()))
+}
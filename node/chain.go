@@ -3,13 +3,43 @@ package node
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
+	"sync"
+	"time"
 
 	"github.com/vlayco/blockverse/crypto"
 	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/script"
 	"github.com/vlayco/blockverse/types"
 )
 
+var (
+	// ErrUnknownParent is returned for blocks whose previous block we don't
+	// have.
+	ErrUnknownParent = errors.New("unknown previous block")
+	// ErrInvalidTransaction is returned for transactions that can never be
+	// valid, because they are malformed, incorrectly signed or overspend.
+	ErrInvalidTransaction = errors.New("invalid transaction")
+	// ErrMissingInput is returned for transactions spending an output that
+	// does not exist or is already spent.
+	ErrMissingInput = errors.New("missing transaction input")
+	// ErrTxLocked is returned for transactions that are not final yet or
+	// spend an output that is still timelocked.
+	ErrTxLocked = errors.New("transaction is timelocked")
+	// ErrInvalidNonce is returned for account transactions whose nonce is
+	// not the next nonce of the sending account.
+	ErrInvalidNonce = errors.New("invalid account nonce")
+	// ErrInsufficientBalance is returned for account transactions whose
+	// sender can't pay the amount and fee.
+	ErrInsufficientBalance = errors.New("insufficient account balance")
+)
+
+// maxTimeDrift is how far the timestamp of a block may be ahead of our clock,
+// allowing for clocks of validators that are a bit off.
+const maxTimeDrift = time.Minute
+
 type HeaderList struct {
 	headers []*proto.Header
 }
@@ -32,6 +62,13 @@ func (list *HeaderList) Get(index int) *proto.Header {
 	return list.headers[index]
 }
 
+// Pop removes the last header from the list.
+func (list *HeaderList) Pop() *proto.Header {
+	h := list.headers[list.Len()-1]
+	list.headers = list.headers[:list.Len()-1]
+	return h
+}
+
 func (list *HeaderList) Height() int {
 	return list.Len() - 1
 }
@@ -40,78 +77,783 @@ func (list *HeaderList) Len() int {
 	return len(list.headers)
 }
 
+// blockNode is an entry of the block index, which holds the blocks of the
+// main chain as well as those of the side branches.
+type blockNode struct {
+	hash   string
+	header *proto.Header
+	parent *blockNode
+	height int
+}
+
+// reorg describes a change of the main chain, either a new tip extending it
+// or a switch to another branch.
+type reorg struct {
+	// disconnected are the blocks removed from the main chain, tip first.
+	disconnected []*proto.Block
+	// connected are the blocks added to the main chain, in chain order.
+	connected []*proto.Block
+}
+
+// Chain keeps track of all the valid blocks it has seen, organized as a tree
+// rooted at the genesis block. The main chain is the longest branch of the
+// tree; when a side branch becomes longer the chain reorganizes onto it.
 type Chain struct {
+	lock       sync.RWMutex
 	blockStore BlockStorer
-	headers    *HeaderList
+	utxoStore  UTXOStorer
+	// headers are the headers of the main chain, indexed by height.
+	headers *HeaderList
+	index   map[string]*blockNode
+	tip     *blockNode
+	// pending holds the blocks of side branches that were never part of the
+	// main chain. Blocks are only persisted once they are connected.
+	pending map[string]*proto.Block
+	// undo holds the outputs spent by every block of the main chain, so they
+	// can be restored when the block gets disconnected.
+	undo map[string][]*UTXO
+	// accounts holds the state of the accounts used by account transactions,
+	// by hex encoded address.
+	accounts map[string]*Account
+	// validators are the public keys of the validators taking turns in
+	// proposing blocks.
+	validators  [][]byte
+	blockReward int64
+	onUpdate    func(disconnected, connected []*proto.Block)
+	// now is the clock the timelocks of transactions outside of blocks are
+	// checked against.
+	now func() time.Time
 }
 
-func NewChain(bs BlockStorer) *Chain {
+// NewChain creates a chain starting with the block of the given genesis on top
+// of the given block store. If the store already holds blocks the chain is
+// rebuilt from them.
+func NewChain(bs BlockStorer, genesis *Genesis) (*Chain, error) {
+	genesisBlock, err := genesis.Block()
+	if err != nil {
+		return nil, err
+	}
+
 	chain := &Chain{
-		blockStore: bs,
-		headers:    NewHeaderList(),
+		blockStore:  bs,
+		utxoStore:   NewMemoryUTXOStore(),
+		headers:     NewHeaderList(),
+		index:       make(map[string]*blockNode),
+		pending:     make(map[string]*proto.Block),
+		undo:        make(map[string][]*UTXO),
+		accounts:    genesis.accounts(),
+		validators:  genesis.validators(),
+		blockReward: genesis.BlockReward,
+		now:         time.Now,
+	}
+
+	if lister, ok := bs.(BlockLister); ok {
+		blocks, err := lister.Blocks()
+		if err != nil {
+			return nil, err
+		}
+		if len(blocks) > 0 {
+			return chain, chain.replay(genesisBlock, blocks)
+		}
+	}
+
+	return chain, chain.addGenesisBlock(genesisBlock)
+}
+
+// replay applies the given stored blocks, starting with the genesis block,
+// to rebuild the block index and the UTXO set of the chain.
+func (c *Chain) replay(genesisBlock *proto.Block, blocks []*proto.Block) error {
+	if !bytes.Equal(types.HashBlock(genesisBlock), types.HashBlock(blocks[0])) {
+		return fmt.Errorf("stored chain has a different genesis block")
+	}
+	if err := c.addGenesisBlock(blocks[0]); err != nil {
+		return err
+	}
+
+	for _, b := range blocks[1:] {
+		if _, err := c.addBlock(b); err != nil {
+			return fmt.Errorf("stored block at height (%d): %w", b.Header.Height, err)
+		}
+	}
+	return nil
+}
+
+func (c *Chain) addGenesisBlock(b *proto.Block) error {
+	if err := c.connectBlock(b); err != nil {
+		return err
+	}
+
+	hash := hex.EncodeToString(types.HashBlock(b))
+	c.tip = &blockNode{
+		hash:   hash,
+		header: b.Header,
+	}
+	c.index[hash] = c.tip
+	return nil
+}
+
+// OnUpdate registers the function called after blocks were added to the main
+// chain, with the blocks removed from and added to it. Only a switch to
+// another branch removes blocks; blocks stored on a side branch don't change
+// the main chain.
+func (c *Chain) OnUpdate(fn func(disconnected, connected []*proto.Block)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.onUpdate = fn
+}
+
+// Proposer returns the public key of the validator whose turn it is to
+// propose the block at the given height.
+func (c *Chain) Proposer(height int) []byte {
+	return c.validators[height%len(c.validators)]
+}
+
+// IsValidator reports whether the public key belongs to a validator.
+func (c *Chain) IsValidator(pubKey []byte) bool {
+	for _, v := range c.validators {
+		if bytes.Equal(v, pubKey) {
+			return true
+		}
 	}
-	chain.addBlock(createGenesisBlock())
-	return chain
+	return false
 }
 
 func (c *Chain) Height() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
 	return c.headers.Height()
 }
 
+// AddBlock validates the block and adds it to the chain. A block extending
+// the main chain becomes its new tip, any other block is kept on a side
+// branch, which becomes the main chain once it is longer.
 func (c *Chain) AddBlock(b *proto.Block) error {
-	if err := c.ValidateBlock(b); err != nil {
+	c.lock.Lock()
+	r, err := c.addBlock(b)
+	onUpdate := c.onUpdate
+	c.lock.Unlock()
+
+	if err != nil {
 		return err
 	}
-	return c.addBlock(b)
+	if r != nil && onUpdate != nil {
+		onUpdate(r.disconnected, r.connected)
+	}
+	return nil
+}
+
+// HasBlock reports whether the block with the given hash is already part of
+// the chain, either on the main chain or on a side branch.
+func (c *Chain) HasBlock(hash []byte) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	_, ok := c.index[hex.EncodeToString(hash)]
+	return ok
+}
+
+func (c *Chain) addBlock(b *proto.Block) (*reorg, error) {
+	if b.Header == nil {
+		return nil, fmt.Errorf("block has no header")
+	}
+
+	hash := hex.EncodeToString(types.HashBlock(b))
+	if _, ok := c.index[hash]; ok {
+		return nil, fmt.Errorf("block [%s] already exists", hash)
+	}
+
+	parent, ok := c.index[hex.EncodeToString(b.Header.PrevHash)]
+	if !ok {
+		return nil, ErrUnknownParent
+	}
+
+	if err := c.validateHeader(b, parent); err != nil {
+		return nil, err
+	}
+
+	node := &blockNode{
+		hash:   hash,
+		header: b.Header,
+		parent: parent,
+		height: parent.height + 1,
+	}
+
+	if parent == c.tip {
+		if err := c.validateTransactions(b); err != nil {
+			return nil, err
+		}
+		if err := c.connectBlock(b); err != nil {
+			return nil, err
+		}
+		c.index[hash] = node
+		c.tip = node
+		return &reorg{connected: []*proto.Block{b}}, nil
+	}
+
+	c.index[hash] = node
+	c.pending[hash] = b
+
+	// The side branch is not longer than the main chain, so we stay on the
+	// first branch we've seen.
+	if node.height <= c.tip.height {
+		return nil, nil
+	}
+	return c.reorganize(node)
+}
+
+// reorganize makes the branch ending in newTip the main chain. If a block of
+// the branch turns out to be invalid the original main chain is restored.
+func (c *Chain) reorganize(newTip *blockNode) (*reorg, error) {
+	var (
+		oldTip = c.tip
+		fork   = findFork(oldTip, newTip)
+		r      = &reorg{}
+	)
+
+	for node := oldTip; node != fork; node = node.parent {
+		b, err := c.getBlock(node.hash)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.disconnectBlock(b); err != nil {
+			return nil, err
+		}
+		r.disconnected = append(r.disconnected, b)
+	}
+
+	var branch []*blockNode
+	for node := newTip; node != fork; node = node.parent {
+		branch = append([]*blockNode{node}, branch...)
+	}
+
+	for i, node := range branch {
+		b, err := c.getBlock(node.hash)
+		if err != nil {
+			return nil, err
+		}
+
+		err = c.validateTransactions(b)
+		if err == nil {
+			err = c.connectBlock(b)
+		}
+		if err != nil {
+			// Forget the invalid block and the blocks building on it, and go
+			// back to the main chain we had.
+			for _, invalid := range branch[i:] {
+				delete(c.index, invalid.hash)
+				delete(c.pending, invalid.hash)
+			}
+			if rerr := c.restore(r, oldTip); rerr != nil {
+				return nil, rerr
+			}
+			return nil, fmt.Errorf("invalid block [%s] on side branch: %w", node.hash, err)
+		}
+		r.connected = append(r.connected, b)
+	}
+
+	c.tip = newTip
+	return r, nil
+}
+
+// restore undoes a partially applied reorganization.
+func (c *Chain) restore(r *reorg, oldTip *blockNode) error {
+	for i := len(r.connected) - 1; i >= 0; i-- {
+		if err := c.disconnectBlock(r.connected[i]); err != nil {
+			return err
+		}
+	}
+	for i := len(r.disconnected) - 1; i >= 0; i-- {
+		if err := c.connectBlock(r.disconnected[i]); err != nil {
+			return err
+		}
+	}
+	c.tip = oldTip
+	return nil
+}
+
+// findFork returns the last block the branches ending in a and b have in
+// common.
+func findFork(a, b *blockNode) *blockNode {
+	for a.height > b.height {
+		a = a.parent
+	}
+	for b.height > a.height {
+		b = b.parent
+	}
+	for a != b {
+		a = a.parent
+		b = b.parent
+	}
+	return a
 }
 
-func (c *Chain) addBlock(b *proto.Block) error {
+// connectBlock persists the block and applies it on top of the main chain.
+// The spent outputs and the senders of the account transactions are looked up
+// before anything is changed, so a block that can't be connected leaves the
+// chain as it was.
+func (c *Chain) connectBlock(b *proto.Block) error {
+	var (
+		hash    = hex.EncodeToString(types.HashBlock(b))
+		spent   = []*UTXO{}
+		senders = make([]string, len(b.Transactions))
+		seen    = make(map[string]bool)
+	)
+	for i, tx := range b.Transactions {
+		if types.IsAccountTransaction(tx) {
+			from, err := accountAddress(tx.Account)
+			if err != nil {
+				return err
+			}
+			senders[i] = from
+		}
+		for _, input := range spentInputs(tx) {
+			key := utxoKey(hex.EncodeToString(input.PrevTxHash), int(input.PrevOutIndex))
+			if seen[key] {
+				return fmt.Errorf("utxo [%s] is spent twice", key)
+			}
+			seen[key] = true
+			utxo, err := c.utxoStore.Get(key)
+			if err != nil {
+				return err
+			}
+			spent = append(spent, utxo)
+		}
+	}
+
+	if err := c.blockStore.Put(b); err != nil {
+		return err
+	}
+	delete(c.pending, hash)
+
 	// add the headers to the list of headers.
 	c.headers.Add(b.Header)
-	// validation
-	return c.blockStore.Put(b)
+
+	// Spend the outputs referenced by the inputs and make the new outputs
+	// available for spending.
+	for i, tx := range b.Transactions {
+		if senders[i] != "" {
+			c.applyAccountTransaction(senders[i], tx.Account)
+		}
+		txHash := hex.EncodeToString(types.HashTransaction(tx))
+		for _, input := range spentInputs(tx) {
+			key := utxoKey(hex.EncodeToString(input.PrevTxHash), int(input.PrevOutIndex))
+			if err := c.utxoStore.Delete(key); err != nil {
+				return err
+			}
+		}
+		for i, output := range tx.Outputs {
+			utxo := &UTXO{
+				Hash:          txHash,
+				OutIndex:      i,
+				Amount:        output.Amount,
+				Address:       output.Address,
+				PublicKeys:    output.PublicKeys,
+				Threshold:     output.Threshold,
+				LockHeight:    output.LockHeight,
+				LockingScript: output.LockingScript,
+			}
+			if err := c.utxoStore.Put(utxo); err != nil {
+				return err
+			}
+		}
+	}
+	c.undo[hash] = spent
+
+	return nil
+}
+
+// spentInputs returns the inputs of the transaction that spend an output,
+// which are all of them except for the input of a coinbase transaction.
+func spentInputs(tx *proto.Transaction) []*proto.TxInput {
+	if types.IsCoinbase(tx) {
+		return nil
+	}
+	return tx.Inputs
+}
+
+// disconnectBlock removes the tip of the main chain, restoring the outputs
+// it spent and removing the outputs it created.
+func (c *Chain) disconnectBlock(b *proto.Block) error {
+	hash := hex.EncodeToString(types.HashBlock(b))
+
+	for _, tx := range b.Transactions {
+		txHash := hex.EncodeToString(types.HashTransaction(tx))
+		for i := range tx.Outputs {
+			if err := c.utxoStore.Delete(utxoKey(txHash, i)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, utxo := range c.undo[hash] {
+		if err := c.utxoStore.Put(utxo); err != nil {
+			return err
+		}
+	}
+	delete(c.undo, hash)
+
+	for i := len(b.Transactions) - 1; i >= 0; i-- {
+		if tx := b.Transactions[i]; types.IsAccountTransaction(tx) {
+			if err := c.revertAccountTransaction(tx.Account); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.headers.Pop()
+	return nil
+}
+
+// getBlock returns the block with the given hex encoded hash, whether or not
+// it was ever part of the main chain.
+func (c *Chain) getBlock(hash string) (*proto.Block, error) {
+	if b, ok := c.pending[hash]; ok {
+		return b, nil
+	}
+	return c.blockStore.Get(hash)
 }
 
 func (c *Chain) GetBlockByHash(hash []byte) (*proto.Block, error) {
-	hashHex := hex.EncodeToString(hash)
-	return c.blockStore.Get(hashHex)
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.getBlock(hex.EncodeToString(hash))
 }
 
 func (c *Chain) GetBlockByHeight(height int) (*proto.Block, error) {
-	if c.Height() < height {
-		return nil, fmt.Errorf("given height (%d) to high - height (%d)", height, c.Height())
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.headers.Height() < height {
+		return nil, fmt.Errorf("given height (%d) to high - height (%d)", height, c.headers.Height())
 	}
 	header := c.headers.Get(height)
 	hash := types.HashHeader(header)
-	return c.GetBlockByHash(hash)
+	return c.getBlock(hex.EncodeToString(hash))
 }
 
+// ValidateBlock checks whether the block is a valid extension of the main
+// chain.
 func (c *Chain) ValidateBlock(b *proto.Block) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if b.Header == nil {
+		return fmt.Errorf("block has no header")
+	}
+	// Validate if the prevHash is the acctual hash of the current block.
+	if hex.EncodeToString(b.Header.PrevHash) != c.tip.hash {
+		return fmt.Errorf("invalid previous block hash")
+	}
+	if err := c.validateHeader(b, c.tip); err != nil {
+		return err
+	}
+	return c.validateTransactions(b)
+}
+
+// validateHeader checks the parts of the block that don't depend on the state
+// of the chain it extends.
+func (c *Chain) validateHeader(b *proto.Block, parent *blockNode) error {
 	// Validate the signature of the block.
 	if !types.VerifyBlock(b) {
 		return fmt.Errorf("invalid block signature")
 	}
 
-	// Validate if the prevHash is the acctual hash of the current block.
-	currentBlock, err := c.GetBlockByHeight(c.Height())
+	if int(b.Header.Height) != parent.height+1 {
+		return fmt.Errorf("invalid block height (%d) - expected (%d)", b.Header.Height, parent.height+1)
+	}
+
+	// The timestamps of blocks have to increase, and can't be far in the
+	// future, since the timelocks of transactions are checked against them.
+	if b.Header.Timestamp <= parent.header.Timestamp {
+		return fmt.Errorf("block timestamp (%d) not after its parent (%d)", b.Header.Timestamp, parent.header.Timestamp)
+	}
+	if maxTime := c.now().Add(maxTimeDrift).UnixNano(); b.Header.Timestamp > maxTime {
+		return fmt.Errorf("block timestamp (%d) too far in the future (%d)", b.Header.Timestamp, maxTime)
+	}
+
+	// Only the validator whose turn it is may propose the block.
+	if !bytes.Equal(b.PublicKey, c.Proposer(int(b.Header.Height))) {
+		return fmt.Errorf("block at height (%d) not signed by the expected proposer", b.Header.Height)
+	}
+
+	// Validate if the root hash commits to the transactions of the block.
+	if !bytes.Equal(types.CalculateRootHash(b.Transactions), b.Header.RootHash) {
+		return fmt.Errorf("invalid block root hash")
+	}
+	return nil
+}
+
+// validateTransactions validates the transactions of the block against the
+// UTXO set of the main chain. The first transaction of the block has to be the
+// coinbase, paying at most the block reward plus the fees of the block.
+func (c *Chain) validateTransactions(b *proto.Block) error {
+	if len(b.Transactions) == 0 || !types.IsCoinbase(b.Transactions[0]) {
+		return fmt.Errorf("block has no coinbase transaction")
+	}
+
+	var (
+		state = newBlockState()
+		fees  int64
+	)
+	state.verified = verifySignatures(b.Transactions[1:])
+	for _, tx := range b.Transactions[1:] {
+		fee, err := c.validateTransaction(tx, state, b.Header.Height, b.Header.Timestamp)
+		if err != nil {
+			return err
+		}
+		fees += fee
+	}
+
+	return c.validateCoinbase(b.Transactions[0], b.Header.Height, fees)
+}
+
+// verifySignatures verifies the signatures of all the transactions as a batch on
+// a pool of workers. If it fails the transactions are verified one by one to
+// find the invalid one.
+func verifySignatures(txx []*proto.Transaction) bool {
+	v := crypto.NewBatchVerifier(0)
+	for _, tx := range txx {
+		if validateTransactionStructure(tx) != nil || !types.AddTransactionSignatures(v, tx) {
+			return false
+		}
+	}
+	return v.Verify()
+}
+
+func (c *Chain) validateCoinbase(tx *proto.Transaction, height int32, fees int64) error {
+	input := tx.Inputs[0]
+	if input.PrevOutIndex != uint32(height) {
+		return fmt.Errorf("coinbase height (%d) does not match block height (%d)", input.PrevOutIndex, height)
+	}
+	// An account transfer in the coinbase would be applied without being
+	// signed by the sender.
+	if tx.Account != nil {
+		return fmt.Errorf("coinbase with an account transaction")
+	}
+	if tx.LockHeight != 0 || tx.LockTime != 0 {
+		return fmt.Errorf("coinbase with a timelock")
+	}
+	// The coinbase input spends nothing, so there is nothing to unlock.
+	if len(input.PublicKey) != 0 || len(input.Signature) != 0 || len(input.UnlockingScript) != 0 ||
+		len(input.PublicKeys) != 0 || len(input.Signatures) != 0 {
+		return fmt.Errorf("coinbase input with a public key, signature or unlocking script")
+	}
+	if len(tx.Outputs) == 0 {
+		return fmt.Errorf("coinbase has no outputs")
+	}
+	for i, output := range tx.Outputs {
+		if err := types.ValidateOutput(output); err != nil {
+			return fmt.Errorf("invalid coinbase output (%d): %w", i, err)
+		}
+	}
+
+	amount, err := sumOutputs(tx)
 	if err != nil {
 		return err
 	}
-	hash := types.HashBlock(currentBlock)
-	if !bytes.Equal(hash, b.Header.PrevHash) {
-		return fmt.Errorf("invalid previous block hash")
+	if amount > c.blockReward+fees {
+		return fmt.Errorf("coinbase amount (%d) exceeds block reward (%d) plus fees (%d)", amount, c.blockReward, fees)
 	}
 	return nil
 }
 
-func createGenesisBlock() *proto.Block {
-	privKey := crypto.GeneratePrivateKey()
-	block := &proto.Block{
-		Header: &proto.Header{
-			Version: 1,
-		},
+// BlockReward returns the amount of new coins a block may create.
+func (c *Chain) BlockReward() int64 {
+	return c.blockReward
+}
+
+// ValidateTransaction checks that the transaction is correctly signed and only
+// spends outputs that are unspent and owned by the signers, without creating
+// more coins than it consumes.
+func (c *Chain) ValidateTransaction(tx *proto.Transaction) error {
+	_, err := c.TransactionFee(tx)
+	return err
+}
+
+// TransactionFee validates the transaction and returns the fee it pays, which
+// is the amount of its inputs not spent by its outputs. Its timelocks are
+// checked against the next block height and the current time.
+func (c *Chain) TransactionFee(tx *proto.Transaction) (int64, error) {
+	fees, errs := c.TransactionFees([]*proto.Transaction{tx})
+	return fees[0], errs[0]
+}
+
+// TransactionFees validates the transactions in order like TransactionFee,
+// each on top of the valid transactions before it, as if they were included
+// in the next block. This allows consecutive nonces of an account. It returns
+// the fee of every transaction, or the error making it invalid.
+func (c *Chain) TransactionFees(txx []*proto.Transaction) ([]int64, []error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	var (
+		state     = newBlockState()
+		height    = int32(c.tip.height + 1)
+		timestamp = c.now().UnixNano()
+		fees      = make([]int64, len(txx))
+		errs      = make([]error, len(txx))
+	)
+	for i, tx := range txx {
+		fees[i], errs[i] = c.validateTransaction(tx, state, height, timestamp)
+	}
+	return fees, errs
+}
+
+// blockState holds the changes made by the transactions of a block validated
+// so far, which the following transactions of the block are validated on top
+// of.
+type blockState struct {
+	// spent holds the outputs spent, which can only be spent once across all
+	// the transactions of the block.
+	spent    map[string]bool
+	accounts map[string]*Account
+	// verified is set if the signatures of the transactions of the block
+	// have already been verified together, see verifySignatures.
+	verified bool
+}
+
+func newBlockState() *blockState {
+	return &blockState{
+		spent:    make(map[string]bool),
+		accounts: make(map[string]*Account),
+	}
+}
+
+// validateTransaction validates the transaction against the current UTXO set
+// and accounts for inclusion in a block at the given height and timestamp, and
+// returns its fee. The block state gets updated with the changes made by tx,
+// but only if it is valid.
+func (c *Chain) validateTransaction(tx *proto.Transaction, state *blockState, height int32, timestamp int64) (int64, error) {
+	if err := validateTransactionStructure(tx); err != nil {
+		return 0, err
+	}
+
+	if !types.IsFinal(tx, height, timestamp) {
+		return 0, fmt.Errorf("%w: locked until height (%d) and time (%d)", ErrTxLocked, tx.LockHeight, tx.LockTime)
+	}
+
+	if !state.verified && !types.VerifyTransaction(tx) {
+		return 0, fmt.Errorf("%w: invalid signature", ErrInvalidTransaction)
+	}
+
+	if types.IsAccountTransaction(tx) {
+		return c.validateAccountTransaction(tx, state)
 	}
-	types.SignBlock(privKey, block)
 
-	return block
+	var (
+		inputSum int64
+		spent    = make([]string, 0, len(tx.Inputs))
+	)
+	for i, input := range tx.Inputs {
+		key := utxoKey(hex.EncodeToString(input.PrevTxHash), int(input.PrevOutIndex))
+		if state.spent[key] {
+			return 0, fmt.Errorf("%w: utxo [%s] is spent by another transaction", ErrMissingInput, key)
+		}
+
+		utxo, err := c.utxoStore.Get(key)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %s", ErrMissingInput, err)
+		}
+
+		switch {
+		case len(utxo.LockingScript) > 0:
+			err := types.VerifyInputScript(tx, i, utxo.LockingScript, height)
+			if errors.Is(err, script.ErrLocked) {
+				return 0, fmt.Errorf("%w: utxo [%s]: %s", ErrTxLocked, key, err)
+			}
+			if err != nil {
+				return 0, fmt.Errorf("%w: utxo [%s]: %s", ErrInvalidTransaction, key, err)
+			}
+		case len(utxo.PublicKeys) > 0:
+			if !types.SatisfiesMultisig(input, utxo.PublicKeys, utxo.Threshold) {
+				return 0, fmt.Errorf("%w: utxo [%s] lacks (%d) multisig signatures", ErrInvalidTransaction, key, utxo.Threshold)
+			}
+		default:
+			if types.IsMultisigInput(input) || types.IsScriptInput(input) {
+				return 0, fmt.Errorf("%w: input does not match the type of utxo [%s]", ErrInvalidTransaction, key)
+			}
+			// Outputs locked to legacy addresses, like the allocs of old
+			// genesis files, remain spendable by their keys.
+			pubKey, err := crypto.ParsePublicKey(input.PublicKey)
+			if err != nil {
+				return 0, fmt.Errorf("%w: %s", ErrInvalidTransaction, err)
+			}
+			// The chain doesn't know its network, so the address is shown
+			// like the wallet does by default.
+			if !pubKey.Owns(utxo.Address) {
+				return 0, fmt.Errorf("%w: utxo [%s] is not owned by %s", ErrInvalidTransaction, key, pubKey.Address().Encode(crypto.MainNetPrefix))
+			}
+		}
+
+		if utxo.LockHeight > height {
+			return 0, fmt.Errorf("%w: utxo [%s] is locked until height (%d)", ErrTxLocked, key, utxo.LockHeight)
+		}
+
+		spent = append(spent, key)
+		inputSum += utxo.Amount
+	}
+
+	outputSum, err := sumOutputs(tx)
+	if err != nil {
+		return 0, err
+	}
+
+	if outputSum > inputSum {
+		return 0, fmt.Errorf("%w: outputs (%d) exceed inputs (%d)", ErrInvalidTransaction, outputSum, inputSum)
+	}
+
+	for _, key := range spent {
+		state.spent[key] = true
+	}
+	return inputSum - outputSum, nil
+}
+
+// validateTransactionStructure checks the parts of the transaction that don't
+// depend on the state of the chain.
+func validateTransactionStructure(tx *proto.Transaction) error {
+	if types.IsAccountTransaction(tx) {
+		return validateAccountStructure(tx)
+	}
+
+	if len(tx.Inputs) == 0 {
+		return fmt.Errorf("%w: no inputs", ErrInvalidTransaction)
+	}
+	if len(tx.Outputs) == 0 {
+		return fmt.Errorf("%w: no outputs", ErrInvalidTransaction)
+	}
+
+	// Coinbase transactions are only valid as the first transaction of a
+	// block.
+	if types.IsCoinbase(tx) {
+		return fmt.Errorf("%w: unexpected coinbase transaction", ErrInvalidTransaction)
+	}
+
+	seen := make(map[string]bool)
+	for _, input := range tx.Inputs {
+		key := utxoKey(hex.EncodeToString(input.PrevTxHash), int(input.PrevOutIndex))
+		if seen[key] {
+			return fmt.Errorf("%w: duplicate input [%s]", ErrInvalidTransaction, key)
+		}
+		seen[key] = true
+	}
+
+	for i, output := range tx.Outputs {
+		if err := types.ValidateOutput(output); err != nil {
+			return fmt.Errorf("%w: output (%d): %s", ErrInvalidTransaction, i, err)
+		}
+	}
+	return nil
+}
+
+// sumOutputs returns the total amount of the outputs of the transaction.
+func sumOutputs(tx *proto.Transaction) (int64, error) {
+	var sum int64
+	for _, output := range tx.Outputs {
+		if output.Amount < 0 {
+			return 0, fmt.Errorf("%w: negative output amount (%d)", ErrInvalidTransaction, output.Amount)
+		}
+		if sum > math.MaxInt64-output.Amount {
+			return 0, fmt.Errorf("%w: total output amount overflows", ErrInvalidTransaction)
+		}
+		sum += output.Amount
+	}
+	return sum, nil
 }
@@ -1,35 +1,60 @@
 package node
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/vlayco/blockverse/crypto"
 	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/script"
 	"github.com/vlayco/blockverse/types"
 	"github.com/vlayco/blockverse/util"
 )
 
+func newChain(t testing.TB) *Chain {
+	chain, err := NewChain(NewMemoryBlockStore(), DefaultGenesis())
+	require.NoError(t, err)
+	return chain
+}
+
+// validatorKey returns the key of the validator of the default genesis.
+func validatorKey() *crypto.PrivateKey {
+	return crypto.NewPrivateKeyFromString(DevSeed)
+}
+
+// coinbase returns a coinbase transaction for the block at the given height
+// paying the block reward and the fees to a random address.
+func coinbase(height int32, fees int64) *proto.Transaction {
+	address := crypto.GeneratePrivateKey().Public().Address().Bytes()
+	return types.NewCoinbaseTransaction(height, address, DefaultGenesis().BlockReward+fees)
+}
+
 func randomBlock(t *testing.T, chain *Chain) *proto.Block {
-	privKey := crypto.GeneratePrivateKey()
+	privKey := validatorKey()
 	b := util.RandomBlock()
 	prevBlock, err := chain.GetBlockByHeight(chain.Height())
 	require.NoError(t, err)
 	b.Header.PrevHash = types.HashBlock(prevBlock)
+	b.Header.Height = int32(chain.Height() + 1)
+	b.Transactions = []*proto.Transaction{coinbase(b.Header.Height, 0)}
+	b.Header.RootHash = types.CalculateRootHash(b.Transactions)
 	types.SignBlock(privKey, b)
 	return b
 }
 
 func TestNewChain(t *testing.T) {
-	chain := NewChain(NewMemoryBlockStore())
+	chain := newChain(t)
 	assert.Equal(t, 0, chain.Height())
 	_, err := chain.GetBlockByHeight(0)
 	assert.NoError(t, err)
 }
 
 func TestChainHeight(t *testing.T) {
-	chain := NewChain(NewMemoryBlockStore())
+	chain := newChain(t)
 
 	for i := 0; i < 1000; i++ {
 		b := randomBlock(t, chain)
@@ -41,7 +66,7 @@ func TestChainHeight(t *testing.T) {
 }
 
 func TestAddBlock(t *testing.T) {
-	chain := NewChain(NewMemoryBlockStore())
+	chain := newChain(t)
 
 	for i := 0; i < 100; i++ {
 		block := randomBlock(t, chain)
@@ -60,3 +85,662 @@ func TestAddBlock(t *testing.T) {
 	}
 
 }
+
+func TestAddBlockInvalid(t *testing.T) {
+	chain := newChain(t)
+
+	block := randomBlock(t, chain)
+	block.Header.Height = 5
+	types.SignBlock(validatorKey(), block)
+	require.Error(t, chain.AddBlock(block))
+
+	block = randomBlock(t, chain)
+	block.Transactions = append(block.Transactions, &proto.Transaction{Version: 1})
+	require.Error(t, chain.AddBlock(block))
+
+	require.Equal(t, 0, chain.Height())
+}
+
+func TestHasBlock(t *testing.T) {
+	chain := newChain(t)
+	block := randomBlock(t, chain)
+	hash := types.HashBlock(block)
+
+	assert.False(t, chain.HasBlock(hash))
+	require.NoError(t, chain.AddBlock(block))
+	assert.True(t, chain.HasBlock(hash))
+
+	// Adding the same block twice is rejected.
+	require.Error(t, chain.AddBlock(block))
+}
+
+// fundAddress adds an unspent output of the given amount owned by privKey to
+// the UTXO set of the chain and returns an input spending it.
+func fundAddress(t *testing.T, chain *Chain, privKey *crypto.PrivateKey, amount int64) *proto.TxInput {
+	utxo := &UTXO{
+		Hash:     hex.EncodeToString(util.RandomHash()),
+		OutIndex: 0,
+		Amount:   amount,
+		Address:  privKey.Public().Address().Bytes(),
+	}
+	require.NoError(t, chain.utxoStore.Put(utxo))
+
+	prevTxHash, err := hex.DecodeString(utxo.Hash)
+	require.NoError(t, err)
+
+	return &proto.TxInput{
+		PrevTxHash:   prevTxHash,
+		PrevOutIndex: uint32(utxo.OutIndex),
+		PublicKey:    privKey.Public().Bytes(),
+	}
+}
+
+func signTransaction(privKey *crypto.PrivateKey, tx *proto.Transaction) {
+	if err := types.SignTransactionInputs(tx, privKey); err != nil {
+		panic(err)
+	}
+}
+
+func TestAddBlockWithTx(t *testing.T) {
+	var (
+		chain     = newChain(t)
+		privKey   = crypto.GeneratePrivateKey()
+		recipient = crypto.GeneratePrivateKey().Public().Address()
+		input     = fundAddress(t, chain, privKey, 100)
+	)
+
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{input},
+		Outputs: []*proto.TxOutput{
+			{Amount: 5, Address: recipient.Bytes()},
+			{Amount: 95, Address: privKey.Public().Address().Bytes()},
+		},
+	}
+	signTransaction(privKey, tx)
+	require.NoError(t, chain.ValidateTransaction(tx))
+
+	block := randomBlock(t, chain)
+	block.Transactions = append(block.Transactions, tx)
+	block.Header.RootHash = types.CalculateRootHash(block.Transactions)
+	types.SignBlock(validatorKey(), block)
+	require.NoError(t, chain.AddBlock(block))
+
+	// The spent output is gone and the new outputs are spendable.
+	_, err := chain.utxoStore.Get(utxoKey(hex.EncodeToString(input.PrevTxHash), 0))
+	assert.Error(t, err)
+
+	txHash := hex.EncodeToString(types.HashTransaction(tx))
+	utxo, err := chain.utxoStore.Get(utxoKey(txHash, 0))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), utxo.Amount)
+	assert.Equal(t, recipient.Bytes(), utxo.Address)
+
+	utxo, err = chain.utxoStore.Get(utxoKey(txHash, 1))
+	require.NoError(t, err)
+	assert.Equal(t, int64(95), utxo.Amount)
+
+	// Spending the same output again is a double spend.
+	assert.Error(t, chain.ValidateTransaction(tx))
+}
+
+func TestValidateTransactionInvalid(t *testing.T) {
+	var (
+		chain   = newChain(t)
+		privKey = crypto.GeneratePrivateKey()
+		address = privKey.Public().Address().Bytes()
+	)
+
+	// Outputs exceed inputs.
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{fundAddress(t, chain, privKey, 100)},
+		Outputs: []*proto.TxOutput{{Amount: 101, Address: address}},
+	}
+	signTransaction(privKey, tx)
+	assert.Error(t, chain.ValidateTransaction(tx))
+
+	// Negative output amounts.
+	tx = &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{fundAddress(t, chain, privKey, 100)},
+		Outputs: []*proto.TxOutput{
+			{Amount: 200, Address: address},
+			{Amount: -100, Address: address},
+		},
+	}
+	signTransaction(privKey, tx)
+	assert.Error(t, chain.ValidateTransaction(tx))
+
+	// Output owned by someone else.
+	otherPrivKey := crypto.GeneratePrivateKey()
+	input := fundAddress(t, chain, otherPrivKey, 100)
+	input.PublicKey = privKey.Public().Bytes()
+	tx = &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{input},
+		Outputs: []*proto.TxOutput{{Amount: 100, Address: address}},
+	}
+	signTransaction(privKey, tx)
+	assert.Error(t, chain.ValidateTransaction(tx))
+
+	// Output that does not exist.
+	tx = &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash: util.RandomHash(),
+			PublicKey:  privKey.Public().Bytes(),
+		}},
+		Outputs: []*proto.TxOutput{{Amount: 1, Address: address}},
+	}
+	signTransaction(privKey, tx)
+	assert.Error(t, chain.ValidateTransaction(tx))
+
+	// The same output spent twice in one block.
+	input = fundAddress(t, chain, privKey, 100)
+	tx1 := &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{input},
+		Outputs: []*proto.TxOutput{{Amount: 100, Address: address}},
+	}
+	signTransaction(privKey, tx1)
+	tx2 := &proto.Transaction{
+		Version: 2,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash:   input.PrevTxHash,
+			PrevOutIndex: input.PrevOutIndex,
+			PublicKey:    input.PublicKey,
+		}},
+		Outputs: []*proto.TxOutput{{Amount: 100, Address: address}},
+	}
+	signTransaction(privKey, tx2)
+	require.NoError(t, chain.ValidateTransaction(tx1))
+	require.NoError(t, chain.ValidateTransaction(tx2))
+
+	block := randomBlock(t, chain)
+	block.Transactions = append(block.Transactions, tx1, tx2)
+	block.Header.RootHash = types.CalculateRootHash(block.Transactions)
+	types.SignBlock(validatorKey(), block)
+	assert.Error(t, chain.AddBlock(block))
+}
+
+// childBlock creates a block on top of parent, which doesn't need to be the
+// tip of the main chain.
+func childBlock(t testing.TB, parent *proto.Block, txx ...*proto.Transaction) *proto.Block {
+	b := util.RandomBlock()
+	b.Header.Height = parent.Header.Height + 1
+	b.Header.PrevHash = types.HashBlock(parent)
+	b.Transactions = append([]*proto.Transaction{coinbase(b.Header.Height, 0)}, txx...)
+	b.Header.RootHash = types.CalculateRootHash(b.Transactions)
+	types.SignBlock(validatorKey(), b)
+	return b
+}
+
+// spendGenesis returns a transaction spending the dev allocation of the
+// genesis block of the chain.
+func spendGenesis(t testing.TB, chain *Chain, amount int64) *proto.Transaction {
+	devKey := crypto.NewPrivateKeyFromString(DevSeed)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash:   types.HashTransaction(genesis.Transactions[0]),
+			PrevOutIndex: 0,
+			PublicKey:    devKey.Public().Bytes(),
+		}},
+		Outputs: []*proto.TxOutput{{
+			Amount:  amount,
+			Address: crypto.GeneratePrivateKey().Public().Address().Bytes(),
+		}},
+	}
+	signTransaction(devKey, tx)
+	return tx
+}
+
+func TestChainReorg(t *testing.T) {
+	chain := newChain(t)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+	genesisUTXO := utxoKey(hex.EncodeToString(types.HashTransaction(genesis.Transactions[0])), 0)
+
+	var disconnected, connected []*proto.Block
+	chain.OnUpdate(func(d, c []*proto.Block) {
+		disconnected, connected = d, c
+	})
+
+	tx := spendGenesis(t, chain, 100)
+	a1 := childBlock(t, genesis, tx)
+	require.NoError(t, chain.AddBlock(a1))
+	_, err = chain.utxoStore.Get(genesisUTXO)
+	require.Error(t, err)
+	assert.Empty(t, disconnected)
+	require.Len(t, connected, 1)
+	assert.Equal(t, types.HashBlock(a1), types.HashBlock(connected[0]))
+
+	// A competing block at the same height stays on a side branch and
+	// doesn't change the main chain.
+	connected = nil
+	b1 := childBlock(t, genesis)
+	require.NoError(t, chain.AddBlock(b1))
+	assert.Nil(t, connected)
+	assert.True(t, chain.HasBlock(types.HashBlock(b1)))
+	assert.Equal(t, 1, chain.Height())
+	tip, err := chain.GetBlockByHeight(1)
+	require.NoError(t, err)
+	assert.Equal(t, types.HashBlock(a1), types.HashBlock(tip))
+
+	// Once the side branch is longer it becomes the main chain.
+	b2 := childBlock(t, b1)
+	require.NoError(t, chain.AddBlock(b2))
+	assert.Equal(t, 2, chain.Height())
+	tip, err = chain.GetBlockByHeight(1)
+	require.NoError(t, err)
+	assert.Equal(t, types.HashBlock(b1), types.HashBlock(tip))
+
+	require.Len(t, disconnected, 1)
+	assert.Equal(t, types.HashBlock(a1), types.HashBlock(disconnected[0]))
+	require.Len(t, connected, 2)
+	assert.Equal(t, types.HashBlock(b1), types.HashBlock(connected[0]))
+	assert.Equal(t, types.HashBlock(b2), types.HashBlock(connected[1]))
+
+	// The transaction of the orphaned block is undone and valid again.
+	_, err = chain.utxoStore.Get(genesisUTXO)
+	require.NoError(t, err)
+	_, err = chain.utxoStore.Get(utxoKey(hex.EncodeToString(types.HashTransaction(tx)), 0))
+	require.Error(t, err)
+	require.NoError(t, chain.ValidateTransaction(tx))
+
+	// And the original branch can take over again.
+	a2 := childBlock(t, a1)
+	require.NoError(t, chain.AddBlock(a2))
+	a3 := childBlock(t, a2)
+	require.NoError(t, chain.AddBlock(a3))
+	assert.Equal(t, 3, chain.Height())
+	_, err = chain.utxoStore.Get(genesisUTXO)
+	require.Error(t, err)
+	assert.Len(t, disconnected, 2)
+	assert.Len(t, connected, 3)
+}
+
+func TestChainReorgInvalidBranch(t *testing.T) {
+	chain := newChain(t)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+
+	a1 := childBlock(t, genesis, spendGenesis(t, chain, 100))
+	require.NoError(t, chain.AddBlock(a1))
+
+	// The side block overspends, which is only detected once it would
+	// become part of the main chain.
+	b1 := childBlock(t, genesis, spendGenesis(t, chain, 2_000_000))
+	require.NoError(t, chain.AddBlock(b1))
+	b2 := childBlock(t, b1)
+	require.Error(t, chain.AddBlock(b2))
+
+	assert.Equal(t, 1, chain.Height())
+	tip, err := chain.GetBlockByHeight(1)
+	require.NoError(t, err)
+	assert.Equal(t, types.HashBlock(a1), types.HashBlock(tip))
+	assert.False(t, chain.HasBlock(types.HashBlock(b1)))
+	assert.False(t, chain.HasBlock(types.HashBlock(b2)))
+
+	// The main chain can still be extended.
+	require.NoError(t, chain.AddBlock(childBlock(t, a1)))
+}
+
+func TestConnectBlockFailureLeavesChain(t *testing.T) {
+	var (
+		chain  = newChain(t)
+		devKey = validatorKey()
+		to     = crypto.GeneratePrivateKey().Public().Address().Bytes()
+	)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+
+	// The account transaction can be applied, but the output spent after it
+	// doesn't exist.
+	missing := spendGenesis(t, chain, 100)
+	missing.Inputs[0].PrevTxHash = util.RandomHash()
+	b := childBlock(t, genesis, accountTx(devKey, to, 10, 0, 0), missing)
+	assert.Error(t, chain.connectBlock(b))
+
+	assert.Equal(t, 0, chain.Height())
+	assert.Equal(t, Account{Balance: 1_000_000}, chain.Account(devKey.Public().Address().Bytes()))
+	assert.Equal(t, Account{}, chain.Account(to))
+	_, err = chain.blockStore.Get(hex.EncodeToString(types.HashBlock(b)))
+	assert.Error(t, err)
+	_, err = chain.utxoStore.Get(utxoKey(hex.EncodeToString(types.HashTransaction(b.Transactions[0])), 0))
+	assert.Error(t, err)
+
+	// The chain goes on as if the block was never seen.
+	b1 := childBlock(t, genesis)
+	require.NoError(t, chain.AddBlock(b1))
+	tip, err := chain.GetBlockByHeight(1)
+	require.NoError(t, err)
+	assert.Equal(t, types.HashBlock(b1), types.HashBlock(tip))
+}
+
+func TestAddBlockUnknownParent(t *testing.T) {
+	chain := newChain(t)
+	block := randomBlock(t, chain)
+	block.Header.PrevHash = util.RandomHash()
+	types.SignBlock(validatorKey(), block)
+	assert.ErrorIs(t, chain.AddBlock(block), ErrUnknownParent)
+}
+
+func TestAddBlockTimestamp(t *testing.T) {
+	chain := newChain(t)
+	now := time.Now()
+	chain.now = func() time.Time { return now }
+
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+	b1 := childBlock(t, genesis)
+	require.NoError(t, chain.AddBlock(b1))
+
+	// Not after the parent.
+	b2 := childBlock(t, b1)
+	b2.Header.Timestamp = b1.Header.Timestamp
+	types.SignBlock(validatorKey(), b2)
+	assert.Error(t, chain.AddBlock(b2))
+
+	// Too far in the future.
+	b2.Header.Timestamp = now.Add(maxTimeDrift + time.Second).UnixNano()
+	types.SignBlock(validatorKey(), b2)
+	assert.Error(t, chain.AddBlock(b2))
+
+	b2.Header.Timestamp = now.Add(maxTimeDrift).UnixNano()
+	types.SignBlock(validatorKey(), b2)
+	assert.NoError(t, chain.AddBlock(b2))
+}
+
+func TestProposerSchedule(t *testing.T) {
+	keys := []*crypto.PrivateKey{
+		crypto.GeneratePrivateKey(),
+		crypto.GeneratePrivateKey(),
+		crypto.GeneratePrivateKey(),
+	}
+	genesis := DefaultGenesis()
+	genesis.Validators = nil
+	for _, key := range keys {
+		genesis.Validators = append(genesis.Validators, hex.EncodeToString(key.Public().Bytes()))
+	}
+
+	chain, err := NewChain(NewMemoryBlockStore(), genesis)
+	require.NoError(t, err)
+	for _, key := range keys {
+		assert.True(t, chain.IsValidator(key.Public().Bytes()))
+	}
+	assert.False(t, chain.IsValidator(crypto.GeneratePrivateKey().Public().Bytes()))
+
+	for height := 1; height <= 6; height++ {
+		assert.Equal(t, keys[height%3].Public().Bytes(), chain.Proposer(height))
+
+		// A validator proposing out of turn is rejected.
+		block := randomBlock(t, chain)
+		types.SignBlock(keys[(height+1)%3], block)
+		require.Error(t, chain.AddBlock(block))
+
+		types.SignBlock(keys[height%3], block)
+		require.NoError(t, chain.AddBlock(block))
+	}
+
+	// Blocks signed by keys outside of the validator set are rejected.
+	block := randomBlock(t, chain)
+	types.SignBlock(crypto.GeneratePrivateKey(), block)
+	require.Error(t, chain.AddBlock(block))
+}
+
+func TestCoinbase(t *testing.T) {
+	chain := newChain(t)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+
+	// blockWith creates a block on top of genesis with the given transactions.
+	blockWith := func(txx ...*proto.Transaction) *proto.Block {
+		b := childBlock(t, genesis)
+		b.Transactions = txx
+		b.Header.RootHash = types.CalculateRootHash(txx)
+		types.SignBlock(validatorKey(), b)
+		return b
+	}
+
+	// The fee of the transaction is 10.
+	tx := spendGenesis(t, chain, 1_000_000-10)
+
+	assert.Error(t, chain.AddBlock(blockWith()), "no coinbase")
+	assert.Error(t, chain.AddBlock(blockWith(tx, coinbase(1, 10))), "coinbase not first")
+	assert.Error(t, chain.AddBlock(blockWith(coinbase(1, 0), coinbase(1, 0))), "two coinbases")
+	assert.Error(t, chain.AddBlock(blockWith(coinbase(2, 0))), "wrong height")
+	assert.Error(t, chain.AddBlock(blockWith(coinbase(1, 11), tx)), "amount too high")
+	assert.Error(t, chain.ValidateTransaction(coinbase(1, 0)))
+
+	// The outputs and the input of the coinbase are checked too.
+	badOutput := coinbase(1, 0)
+	badOutput.Outputs[0].Address = crypto.GeneratePrivateKey().Public().LegacyAddress().Bytes()
+	assert.Error(t, chain.AddBlock(blockWith(badOutput)), "legacy output")
+	badInput := coinbase(1, 0)
+	badInput.Inputs[0].PublicKey = validatorKey().Public().Bytes()
+	assert.Error(t, chain.AddBlock(blockWith(badInput)), "public key")
+	badInput = coinbase(1, 0)
+	badInput.Inputs[0].Signature = validatorKey().Sign([]byte("foo")).Bytes()
+	assert.Error(t, chain.AddBlock(blockWith(badInput)), "signature")
+	badInput = coinbase(1, 0)
+	badInput.Inputs[0].UnlockingScript = []byte{0x01, 0x01}
+	assert.Error(t, chain.AddBlock(blockWith(badInput)), "unlocking script")
+
+	// The coinbase can't move the coins of an account, nor be timelocked.
+	devKey := validatorKey()
+	steal := coinbase(1, 0)
+	steal.Account = &proto.AccountTx{
+		From:   devKey.Public().Bytes(),
+		To:     crypto.GeneratePrivateKey().Public().Address().Bytes(),
+		Amount: 1_000_000,
+	}
+	assert.Error(t, chain.AddBlock(blockWith(steal)), "account transaction")
+	assert.Equal(t, Account{Balance: 1_000_000}, chain.Account(devKey.Public().Address().Bytes()))
+	locked := coinbase(1, 0)
+	locked.LockHeight = 1
+	assert.Error(t, chain.AddBlock(blockWith(locked)), "lock height")
+	locked = coinbase(1, 0)
+	locked.LockTime = 1
+	assert.Error(t, chain.AddBlock(blockWith(locked)), "lock time")
+
+	minerKey := crypto.GeneratePrivateKey()
+	cb := types.NewCoinbaseTransaction(1, minerKey.Public().Address().Bytes(), chain.BlockReward()+10)
+	require.NoError(t, chain.AddBlock(blockWith(cb, tx)))
+
+	// The reward is spendable by the block producer.
+	utxo, err := chain.utxoStore.Get(utxoKey(hex.EncodeToString(types.HashTransaction(cb)), 0))
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), utxo.Amount)
+	assert.Equal(t, minerKey.Public().Address().Bytes(), utxo.Address)
+}
+
+func TestMultisig(t *testing.T) {
+	var (
+		chain = newChain(t)
+		owner = crypto.GeneratePrivateKey()
+		keys  = []*crypto.PrivateKey{
+			crypto.GeneratePrivateKey(),
+			crypto.GeneratePrivateKey(),
+			crypto.GeneratePrivateKey(),
+		}
+	)
+
+	// Lock 100 coins to 2 of 3 keys.
+	fund := &proto.Transaction{
+		Version: 1,
+		Inputs:  []*proto.TxInput{fundAddress(t, chain, owner, 100)},
+		Outputs: []*proto.TxOutput{
+			types.NewMultisigOutput(100, 2, keys[0].Public(), keys[1].Public(), keys[2].Public()),
+		},
+	}
+	signTransaction(owner, fund)
+
+	block := randomBlock(t, chain)
+	block.Transactions = append(block.Transactions, fund)
+	block.Header.RootHash = types.CalculateRootHash(block.Transactions)
+	types.SignBlock(validatorKey(), block)
+	require.NoError(t, chain.AddBlock(block))
+
+	spend := func(signers ...*crypto.PrivateKey) *proto.Transaction {
+		input := &proto.TxInput{PrevTxHash: types.HashTransaction(fund)}
+		for _, signer := range signers {
+			input.PublicKeys = append(input.PublicKeys, signer.Public().Bytes())
+		}
+		tx := &proto.Transaction{
+			Version: 1,
+			Inputs:  []*proto.TxInput{input},
+			Outputs: []*proto.TxOutput{{Amount: 100, Address: owner.Public().Address().Bytes()}},
+		}
+		require.NoError(t, types.SignTransactionInputs(tx, signers...))
+		return tx
+	}
+
+	// Too few signers.
+	assert.ErrorIs(t, chain.ValidateTransaction(spend(keys[0])), ErrInvalidTransaction)
+	// A signer not part of the output.
+	assert.ErrorIs(t, chain.ValidateTransaction(spend(keys[0], owner)), ErrInvalidTransaction)
+	// A single key input can't spend a multisig output.
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash: types.HashTransaction(fund),
+			PublicKey:  keys[0].Public().Bytes(),
+		}},
+		Outputs: []*proto.TxOutput{{Amount: 100, Address: owner.Public().Address().Bytes()}},
+	}
+	signTransaction(keys[0], tx)
+	assert.ErrorIs(t, chain.ValidateTransaction(tx), ErrInvalidTransaction)
+
+	assert.NoError(t, chain.ValidateTransaction(spend(keys[0], keys[2])))
+	assert.NoError(t, chain.ValidateTransaction(spend(keys[2], keys[1], keys[0])))
+
+	// An invalid threshold.
+	invalid := spend(keys[0], keys[1])
+	invalid.Outputs[0] = types.NewMultisigOutput(100, 3, keys[0].Public(), keys[1].Public())
+	require.NoError(t, types.SignTransactionInputs(invalid, keys[0], keys[1]))
+	assert.ErrorIs(t, chain.ValidateTransaction(invalid), ErrInvalidTransaction)
+}
+
+func TestTimelock(t *testing.T) {
+	chain := newChain(t)
+	now := time.Unix(1_800_000_000, 0)
+	chain.now = func() time.Time { return now }
+
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+
+	// The transaction can't be mined before height 2.
+	tx := spendGenesis(t, chain, 100)
+	tx.LockHeight = 2
+	signTransaction(validatorKey(), tx)
+	assert.ErrorIs(t, chain.ValidateTransaction(tx), ErrTxLocked)
+	assert.Error(t, chain.AddBlock(childBlock(t, genesis, tx)))
+
+	b1 := childBlock(t, genesis)
+	require.NoError(t, chain.AddBlock(b1))
+	assert.NoError(t, chain.ValidateTransaction(tx))
+
+	// The transaction can't be mined before its lock time.
+	tx.LockHeight = 0
+	tx.LockTime = now.Add(time.Second).UnixNano()
+	signTransaction(validatorKey(), tx)
+	assert.ErrorIs(t, chain.ValidateTransaction(tx), ErrTxLocked)
+	now = now.Add(time.Second)
+	assert.NoError(t, chain.ValidateTransaction(tx))
+
+	// An output that can't be spent before height 4.
+	tx.LockTime = 0
+	tx.Outputs[0].Address = validatorKey().Public().Address().Bytes()
+	tx.Outputs[0].LockHeight = 4
+	signTransaction(validatorKey(), tx)
+	b2 := childBlock(t, b1, tx)
+	require.NoError(t, chain.AddBlock(b2))
+
+	spend := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash: types.HashTransaction(tx),
+			PublicKey:  validatorKey().Public().Bytes(),
+		}},
+		Outputs: []*proto.TxOutput{{Amount: 100, Address: validatorKey().Public().Address().Bytes()}},
+	}
+	signTransaction(validatorKey(), spend)
+	assert.ErrorIs(t, chain.ValidateTransaction(spend), ErrTxLocked)
+	assert.Error(t, chain.AddBlock(childBlock(t, b2, spend)))
+
+	require.NoError(t, chain.AddBlock(childBlock(t, b2)))
+	assert.NoError(t, chain.ValidateTransaction(spend))
+}
+
+func TestScriptOutput(t *testing.T) {
+	var (
+		chain     = newChain(t)
+		recipient = crypto.GeneratePrivateKey()
+		preimage  = []byte("secret")
+		hash      = sha256.Sum256(preimage)
+	)
+
+	// Lock coins to the preimage of the hash and a signature of the
+	// recipient.
+	tx := spendGenesis(t, chain, 100)
+	tx.Outputs[0] = &proto.TxOutput{
+		Amount:        100,
+		LockingScript: script.HashLock(hash[:], recipient.Public().Bytes()),
+	}
+	signTransaction(validatorKey(), tx)
+
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+	require.NoError(t, chain.AddBlock(childBlock(t, genesis, tx)))
+
+	spend := func(preimage []byte) *proto.Transaction {
+		claim := &proto.Transaction{
+			Version: 1,
+			Inputs:  []*proto.TxInput{{PrevTxHash: types.HashTransaction(tx)}},
+			Outputs: []*proto.TxOutput{{Amount: 100, Address: recipient.Public().Address().Bytes()}},
+		}
+		sig := types.SignTransaction(recipient, claim)
+		claim.Inputs[0].UnlockingScript = script.NewBuilder().AddData(sig.Bytes()).AddData(preimage).Script()
+		return claim
+	}
+	assert.ErrorIs(t, chain.ValidateTransaction(spend([]byte("guess"))), ErrInvalidTransaction)
+	assert.NoError(t, chain.ValidateTransaction(spend(preimage)))
+
+	// A plain signature can't spend a script output.
+	claim := spend(preimage)
+	claim.Inputs[0].UnlockingScript = nil
+	claim.Inputs[0].PublicKey = recipient.Public().Bytes()
+	signTransaction(recipient, claim)
+	assert.ErrorIs(t, chain.ValidateTransaction(claim), ErrInvalidTransaction)
+}
+
+func TestAddBlockVerifiesSignaturesInBatch(t *testing.T) {
+	var (
+		chain  = newChain(t)
+		devKey = validatorKey()
+		to     = crypto.GeneratePrivateKey().Public().Address().Bytes()
+	)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+
+	var txx []*proto.Transaction
+	for nonce := uint64(0); nonce < 32; nonce++ {
+		txx = append(txx, accountTx(devKey, to, 1, 0, nonce))
+	}
+	txx = append(txx, spendGenesis(t, chain, 100))
+
+	// A single invalid signature is found among the others.
+	txx[20].Account.Signature = devKey.Sign([]byte("foo")).Bytes()
+	err = chain.AddBlock(childBlock(t, genesis, txx...))
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+	assert.Equal(t, 0, chain.Height())
+
+	txx[20] = accountTx(devKey, to, 1, 0, 20)
+	require.NoError(t, chain.AddBlock(childBlock(t, genesis, txx...)))
+	assert.Equal(t, Account{Balance: 32}, chain.Account(to))
+}
@@ -0,0 +1,277 @@
+package node
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/types"
+	pb "google.golang.org/protobuf/proto"
+)
+
+const (
+	// maxSegmentSize is the size after which a new segment file is started.
+	maxSegmentSize = 64 << 20
+	// recordHeaderLen is the length of the record header: the payload length
+	// followed by the crc32 checksum of the payload.
+	recordHeaderLen = 8
+	segmentExt      = ".seg"
+)
+
+var (
+	ErrTruncatedRecord = errors.New("truncated block record")
+	ErrCorruptedRecord = errors.New("corrupted block record")
+)
+
+type recordLocation struct {
+	segment int
+	offset  int64
+}
+
+// DiskBlockStore is a BlockStorer that appends blocks as checksummed records
+// to segment files in a directory. An in memory index maps the hash of every
+// block to the location of its record, and is rebuilt from the segments when
+// the store is opened.
+type DiskBlockStore struct {
+	lock     sync.RWMutex
+	dir      string
+	segments []*os.File
+	size     int64 // size of the last segment.
+	index    map[string]recordLocation
+	// hashes of the stored blocks in the order they were put.
+	order []string
+}
+
+func NewDiskBlockStore(dir string) (*DiskBlockStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	s := &DiskBlockStore{
+		dir:   dir,
+		index: make(map[string]recordLocation),
+	}
+	if err := s.open(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// open opens all the segment files in the directory and indexes their
+// records, making sure none of them is truncated or corrupted. Only the last
+// record of the last segment may be truncated, by a crash while it was
+// written, and is then cut off.
+func (s *DiskBlockStore) open() error {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+segmentExt))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		if name != s.segmentPath(i) {
+			return fmt.Errorf("unexpected segment file %s", name)
+		}
+		f, err := os.OpenFile(name, os.O_RDWR, 0644)
+		if err != nil {
+			return err
+		}
+		s.segments = append(s.segments, f)
+
+		size, err := s.indexSegment(i, f, i == len(names)-1)
+		if err != nil {
+			return err
+		}
+		s.size = size
+	}
+
+	if len(s.segments) == 0 {
+		return s.newSegment()
+	}
+	return nil
+}
+
+func (s *DiskBlockStore) indexSegment(segment int, f *os.File, last bool) (int64, error) {
+	var offset int64
+	for {
+		b, n, err := readRecord(f, offset)
+		if err == io.EOF {
+			return offset, nil
+		}
+		if errors.Is(err, ErrTruncatedRecord) && last {
+			if err := f.Truncate(offset); err != nil {
+				return 0, err
+			}
+			return offset, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%s at offset %d: %w", f.Name(), offset, err)
+		}
+
+		hash := hex.EncodeToString(types.HashBlock(b))
+		s.index[hash] = recordLocation{segment: segment, offset: offset}
+		s.order = append(s.order, hash)
+		offset += n
+	}
+}
+
+// readRecord reads the block stored in the record at the given offset and
+// returns it together with the length of the record. io.EOF is returned if
+// there is no record at the offset. The length of the record is checked
+// before reading it, so a damaged header can't make us allocate too much.
+func readRecord(f *os.File, offset int64) (*proto.Block, int64, error) {
+	header := make([]byte, recordHeaderLen)
+	n, err := f.ReadAt(header, offset)
+	if err == io.EOF && n == 0 {
+		return nil, 0, io.EOF
+	}
+	if err == io.EOF {
+		return nil, 0, ErrTruncatedRecord
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		length   = binary.BigEndian.Uint32(header[:4])
+		checksum = binary.BigEndian.Uint32(header[4:])
+	)
+	if length > maxSegmentSize {
+		return nil, 0, fmt.Errorf("%w: invalid length (%d)", ErrCorruptedRecord, length)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset+recordHeaderLen+int64(length) > info.Size() {
+		return nil, 0, ErrTruncatedRecord
+	}
+
+	payload := make([]byte, length)
+	if _, err := f.ReadAt(payload, offset+recordHeaderLen); err != nil {
+		if err == io.EOF {
+			return nil, 0, ErrTruncatedRecord
+		}
+		return nil, 0, err
+	}
+
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, 0, ErrCorruptedRecord
+	}
+
+	b := &proto.Block{}
+	if err := pb.Unmarshal(payload, b); err != nil {
+		return nil, 0, fmt.Errorf("%w: %s", ErrCorruptedRecord, err)
+	}
+
+	return b, recordHeaderLen + int64(length), nil
+}
+
+func (s *DiskBlockStore) segmentPath(segment int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%06d%s", segment, segmentExt))
+}
+
+func (s *DiskBlockStore) newSegment() error {
+	f, err := os.OpenFile(s.segmentPath(len(s.segments)), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, f)
+	s.size = 0
+	return nil
+}
+
+// Put appends the block to the last segment. Blocks that are already stored
+// are not written again.
+func (s *DiskBlockStore) Put(b *proto.Block) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	hash := hex.EncodeToString(types.HashBlock(b))
+	if _, ok := s.index[hash]; ok {
+		return nil
+	}
+
+	payload, err := pb.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	if s.size > 0 && s.size+recordHeaderLen+int64(len(payload)) > maxSegmentSize {
+		if err := s.newSegment(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]byte, recordHeaderLen+len(payload))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[recordHeaderLen:], payload)
+
+	segment := len(s.segments) - 1
+	f := s.segments[segment]
+	if _, err := f.WriteAt(record, s.size); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	s.index[hash] = recordLocation{segment: segment, offset: s.size}
+	s.order = append(s.order, hash)
+	s.size += int64(len(record))
+	return nil
+}
+
+func (s *DiskBlockStore) Get(hash string) (*proto.Block, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	loc, ok := s.index[hash]
+	if !ok {
+		return nil, fmt.Errorf("block with hash [%s] does not exist", hash)
+	}
+
+	b, _, err := readRecord(s.segments[loc.segment], loc.offset)
+	return b, err
+}
+
+// Blocks returns all the stored blocks in the order they were put.
+func (s *DiskBlockStore) Blocks() ([]*proto.Block, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	blocks := make([]*proto.Block, len(s.order))
+	for i, hash := range s.order {
+		loc := s.index[hash]
+		b, _, err := readRecord(s.segments[loc.segment], loc.offset)
+		if err != nil {
+			return nil, err
+		}
+		blocks[i] = b
+	}
+	return blocks, nil
+}
+
+func (s *DiskBlockStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var err error
+	for _, f := range s.segments {
+		if cerr := f.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	s.segments = nil
+	return err
+}
@@ -0,0 +1,157 @@
+package node
+
+import (
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vlayco/blockverse/types"
+	"github.com/vlayco/blockverse/util"
+)
+
+func TestDiskBlockStorePutGet(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskBlockStore(dir)
+	require.NoError(t, err)
+
+	block := util.RandomBlock()
+	hash := hex.EncodeToString(types.HashBlock(block))
+	require.NoError(t, store.Put(block))
+
+	fetched, err := store.Get(hash)
+	require.NoError(t, err)
+	assert.Equal(t, types.HashBlock(block), types.HashBlock(fetched))
+
+	_, err = store.Get(hex.EncodeToString(util.RandomHash()))
+	assert.Error(t, err)
+
+	// The block is still there after reopening the store.
+	require.NoError(t, store.Close())
+	store, err = NewDiskBlockStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	fetched, err = store.Get(hash)
+	require.NoError(t, err)
+	assert.Equal(t, types.HashBlock(block), types.HashBlock(fetched))
+}
+
+func TestDiskBlockStoreRebuildChain(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskBlockStore(dir)
+	require.NoError(t, err)
+
+	chain, err := NewChain(store, DefaultGenesis())
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, chain.AddBlock(randomBlock(t, chain)))
+	}
+	tip, err := chain.GetBlockByHeight(chain.Height())
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = NewDiskBlockStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	chain, err = NewChain(store, DefaultGenesis())
+	require.NoError(t, err)
+	assert.Equal(t, 10, chain.Height())
+
+	rebuiltTip, err := chain.GetBlockByHeight(chain.Height())
+	require.NoError(t, err)
+	assert.Equal(t, types.HashBlock(tip), types.HashBlock(rebuiltTip))
+
+	// The rebuilt chain can be extended.
+	require.NoError(t, chain.AddBlock(randomBlock(t, chain)))
+}
+
+func TestDiskBlockStoreDetectsDamage(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskBlockStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.Put(util.RandomBlock()))
+	require.NoError(t, store.Put(util.RandomBlock()))
+	require.NoError(t, store.Close())
+
+	path := store.segmentPath(0)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// Flip a byte in the payload of the last record.
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, corrupted, 0644))
+	_, err = NewDiskBlockStore(dir)
+	assert.ErrorIs(t, err, ErrCorruptedRecord)
+
+	// A length beyond the size of a segment is rejected before reading it.
+	huge := append([]byte{}, data...)
+	huge = append(huge, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0)
+	require.NoError(t, os.WriteFile(path, huge, 0644))
+	_, err = NewDiskBlockStore(dir)
+	assert.ErrorIs(t, err, ErrCorruptedRecord)
+}
+
+func TestDiskBlockStoreTruncatesTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskBlockStore(dir)
+	require.NoError(t, err)
+	first, second := util.RandomBlock(), util.RandomBlock()
+	require.NoError(t, store.Put(first))
+	require.NoError(t, store.Put(second))
+	require.NoError(t, store.Close())
+
+	// Cut the last record short, as a crash while writing it would.
+	path := store.segmentPath(0)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data[:len(data)-3], 0644))
+
+	store, err = NewDiskBlockStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	blocks, err := store.Blocks()
+	require.NoError(t, err)
+	require.Len(t, blocks, 1)
+	assert.Equal(t, types.HashBlock(first), types.HashBlock(blocks[0]))
+
+	// The torn record is overwritten by the next block.
+	require.NoError(t, store.Put(second))
+	_, err = store.Get(hex.EncodeToString(types.HashBlock(second)))
+	require.NoError(t, err)
+}
+
+func TestDiskBlockStoreRebuildChainWithFork(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskBlockStore(dir)
+	require.NoError(t, err)
+
+	chain, err := NewChain(store, DefaultGenesis())
+	require.NoError(t, err)
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+
+	a1 := childBlock(t, genesis, spendGenesis(t, chain, 100))
+	require.NoError(t, chain.AddBlock(a1))
+	b1 := childBlock(t, genesis)
+	require.NoError(t, chain.AddBlock(b1))
+	b2 := childBlock(t, b1)
+	require.NoError(t, chain.AddBlock(b2))
+	require.NoError(t, store.Close())
+
+	store, err = NewDiskBlockStore(dir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	chain, err = NewChain(store, DefaultGenesis())
+	require.NoError(t, err)
+	assert.Equal(t, 2, chain.Height())
+	tip, err := chain.GetBlockByHeight(2)
+	require.NoError(t, err)
+	assert.Equal(t, types.HashBlock(b2), types.HashBlock(tip))
+	assert.True(t, chain.HasBlock(types.HashBlock(a1)))
+}
@@ -0,0 +1,78 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/types"
+	pb "google.golang.org/protobuf/proto"
+)
+
+// FuzzValidateTransaction feeds transactions decoded from random bytes to the
+// validation of transactions received from the network, which must never
+// panic on them.
+func FuzzValidateTransaction(f *testing.F) {
+	c := newChain(f)
+	devKey := crypto.NewPrivateKeyFromString(DevSeed)
+
+	seeds := []*proto.Transaction{
+		spendGenesis(f, c, 100),
+		accountTx(devKey, crypto.GeneratePrivateKey().Public().Address().Bytes(), 10, 1, 0),
+	}
+	for _, tx := range seeds {
+		b, err := pb.Marshal(tx)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		tx := &proto.Transaction{}
+		if err := pb.Unmarshal(b, tx); err != nil {
+			return
+		}
+		c.ValidateTransaction(tx)
+	})
+}
+
+// FuzzAddBlock feeds blocks decoded from random bytes to the chain, which must
+// never panic on them. The header of each block is fixed up and signed to
+// extend the tip, so the transactions reach validation.
+func FuzzAddBlock(f *testing.F) {
+	c := newChain(f)
+	genesis, err := c.GetBlockByHeight(0)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	b, err := pb.Marshal(childBlock(f, genesis, spendGenesis(f, c, 100)))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b)
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		block := &proto.Block{}
+		if err := pb.Unmarshal(b, block); err != nil {
+			return
+		}
+
+		tip, err := c.GetBlockByHeight(c.Height())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Header == nil {
+			block.Header = &proto.Header{}
+		}
+		block.Header.Height = tip.Header.Height + 1
+		block.Header.PrevHash = types.HashBlock(tip)
+		block.Header.RootHash = types.CalculateRootHash(block.Transactions)
+		block.Header.Timestamp = max(time.Now().UnixNano(), tip.Header.Timestamp+1)
+		types.SignBlock(validatorKey(), block)
+
+		c.AddBlock(block)
+	})
+}
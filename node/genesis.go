@@ -0,0 +1,230 @@
+package node
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/types"
+)
+
+// DevSeed is the seed of the private key funded by the default genesis, which
+// is also its only validator. It is public, so it must only be used on local
+// test networks.
+const DevSeed = "08973e4326d399b3d0c59a60f9087ce744fafe545a0896f4c515f36d11cb9b43"
+
+// GenesisAlloc is an output of the genesis block funding an address, or the
+// initial balance of an account.
+type GenesisAlloc struct {
+	// Address is the address receiving the coins, hex encoded or in the
+	// encoding of a network, like bv1.... Allocs may use legacy addresses,
+	// accounts need versioned ones.
+	Address string `json:"address"`
+	Amount  int64  `json:"amount"`
+}
+
+// Genesis is the specification of the first block of the chain. Every node of
+// a network has to use the same specification to agree on the genesis hash.
+type Genesis struct {
+	ChainID   string `json:"chainId"`
+	Timestamp int64  `json:"timestamp"`
+	// Validators are the hex encoded public keys of the validators.
+	Validators []string `json:"validators"`
+	// BlockReward is the amount of new coins paid to the producer of every
+	// block by its coinbase transaction.
+	BlockReward int64          `json:"blockReward"`
+	Alloc       []GenesisAlloc `json:"alloc"`
+	// Accounts are the initial balances of the accounts used by account
+	// transactions.
+	Accounts []GenesisAlloc `json:"accounts"`
+}
+
+// DefaultGenesis returns the genesis of the local development network, which
+// funds the address and the account of the DevSeed key and makes it the
+// validator.
+func DefaultGenesis() *Genesis {
+	devKey := crypto.NewPrivateKeyFromString(DevSeed)
+	return &Genesis{
+		ChainID:     "blockverse-dev",
+		Timestamp:   1711929600000000000,
+		Validators:  []string{hex.EncodeToString(devKey.Public().Bytes())},
+		BlockReward: 50,
+		Alloc: []GenesisAlloc{
+			{
+				Address: devKey.Public().Address().String(),
+				Amount:  1_000_000,
+			},
+		},
+		Accounts: []GenesisAlloc{
+			{
+				Address: devKey.Public().Address().String(),
+				Amount:  1_000_000,
+			},
+		},
+	}
+}
+
+// LoadGenesis reads a JSON encoded genesis specification from the file.
+func LoadGenesis(path string) (*Genesis, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Genesis{}
+	if err := json.Unmarshal(b, g); err != nil {
+		return nil, fmt.Errorf("invalid genesis file %s: %w", path, err)
+	}
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *Genesis) Validate() error {
+	if g.ChainID == "" {
+		return fmt.Errorf("genesis has no chain id")
+	}
+
+	if len(g.Validators) == 0 {
+		return fmt.Errorf("genesis has no validators")
+	}
+
+	if g.BlockReward < 0 {
+		return fmt.Errorf("invalid genesis block reward (%d)", g.BlockReward)
+	}
+
+	for _, v := range g.Validators {
+		b, err := hex.DecodeString(v)
+		if err != nil || len(b) != crypto.PubKeyLen {
+			return fmt.Errorf("invalid genesis validator public key [%s]", v)
+		}
+	}
+
+	for _, alloc := range g.Alloc {
+		if err := alloc.validate(); err != nil {
+			return fmt.Errorf("invalid genesis alloc: %w", err)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, acc := range g.Accounts {
+		if err := acc.validate(); err != nil {
+			return fmt.Errorf("invalid genesis account: %w", err)
+		}
+		// Account transactions are sent from the versioned address of the
+		// sender, so a legacy account could never be spent.
+		address, _ := acc.address()
+		if len(address) != crypto.AddressLen {
+			return fmt.Errorf("invalid genesis account: legacy address [%s]", acc.Address)
+		}
+		key := hex.EncodeToString(address)
+		if seen[key] {
+			return fmt.Errorf("duplicate genesis account [%s]", acc.Address)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+func (alloc GenesisAlloc) validate() error {
+	// Allocations to legacy addresses are still allowed, so the outputs of
+	// existing genesis blocks stay spendable.
+	b, err := alloc.address()
+	if err != nil || (len(b) != crypto.LegacyAddressLen && crypto.ValidateAddress(b) != nil) {
+		return fmt.Errorf("invalid address [%s]", alloc.Address)
+	}
+	if alloc.Amount <= 0 {
+		return fmt.Errorf("invalid amount (%d) for [%s]", alloc.Amount, alloc.Address)
+	}
+	return nil
+}
+
+// address decodes the hex encoded address of the alloc, or else its encoding
+// for the main or the test network. Legacy addresses can only be hex encoded.
+func (alloc GenesisAlloc) address() ([]byte, error) {
+	if b, err := hex.DecodeString(alloc.Address); err == nil {
+		return b, nil
+	}
+	address, err := crypto.ParseAddress(alloc.Address, crypto.MainNetPrefix)
+	if errors.Is(err, crypto.ErrWrongNetwork) {
+		address, err = crypto.ParseAddress(alloc.Address, crypto.TestNetPrefix)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return address.Bytes(), nil
+}
+
+// Block builds the genesis block. The genesis block is not signed and has no
+// previous block, so its PrevHash commits to the chain ID, the validators, the
+// block reward and the initial accounts instead, which makes the genesis hash
+// unique for every network.
+func (g *Genesis) Block() (*proto.Block, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+
+	tx := &proto.Transaction{
+		Version: 1,
+	}
+	for _, alloc := range g.Alloc {
+		address, _ := alloc.address()
+		tx.Outputs = append(tx.Outputs, &proto.TxOutput{
+			Amount:  alloc.Amount,
+			Address: address,
+		})
+	}
+
+	txx := []*proto.Transaction{tx}
+	return &proto.Block{
+		Header: &proto.Header{
+			Version:   1,
+			Height:    0,
+			PrevHash:  g.hash(),
+			RootHash:  types.CalculateRootHash(txx),
+			Timestamp: g.Timestamp,
+		},
+		Transactions: txx,
+	}, nil
+}
+
+// validators returns the decoded public keys of the validators.
+func (g *Genesis) validators() [][]byte {
+	validators := make([][]byte, len(g.Validators))
+	for i, v := range g.Validators {
+		validators[i], _ = hex.DecodeString(v)
+	}
+	return validators
+}
+
+func (g *Genesis) hash() []byte {
+	h := sha256.New()
+	h.Write([]byte(g.ChainID))
+	for _, v := range g.validators() {
+		h.Write(v)
+	}
+	binary.Write(h, binary.BigEndian, g.BlockReward)
+	for _, acc := range g.Accounts {
+		address, _ := acc.address()
+		h.Write(address)
+		binary.Write(h, binary.BigEndian, acc.Amount)
+	}
+	return h.Sum(nil)
+}
+
+// accounts returns the initial state of the accounts by hex encoded address.
+func (g *Genesis) accounts() map[string]*Account {
+	accounts := make(map[string]*Account, len(g.Accounts))
+	for _, acc := range g.Accounts {
+		address, _ := acc.address()
+		accounts[hex.EncodeToString(address)] = &Account{Balance: acc.Amount}
+	}
+	return accounts
+}
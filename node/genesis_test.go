@@ -0,0 +1,180 @@
+package node
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/types"
+)
+
+func TestGenesisIsDeterministic(t *testing.T) {
+	chainA, err := NewChain(NewMemoryBlockStore(), DefaultGenesis())
+	require.NoError(t, err)
+	chainB, err := NewChain(NewMemoryBlockStore(), DefaultGenesis())
+	require.NoError(t, err)
+
+	genesisA, err := chainA.GetBlockByHeight(0)
+	require.NoError(t, err)
+	genesisB, err := chainB.GetBlockByHeight(0)
+	require.NoError(t, err)
+	assert.Equal(t, types.HashBlock(genesisA), types.HashBlock(genesisB))
+
+	// A block produced on top of one chain is accepted by the other.
+	block := randomBlock(t, chainA)
+	require.NoError(t, chainA.AddBlock(block))
+	require.NoError(t, chainB.AddBlock(block))
+
+	// A different chain ID results in a different genesis.
+	genesis := DefaultGenesis()
+	genesis.ChainID = "other"
+	chainC, err := NewChain(NewMemoryBlockStore(), genesis)
+	require.NoError(t, err)
+	genesisC, err := chainC.GetBlockByHeight(0)
+	require.NoError(t, err)
+	assert.NotEqual(t, types.HashBlock(genesisA), types.HashBlock(genesisC))
+}
+
+func TestGenesisAllocIsSpendable(t *testing.T) {
+	chain := newChain(t)
+	devKey := crypto.NewPrivateKeyFromString(DevSeed)
+
+	genesis, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash:   types.HashTransaction(genesis.Transactions[0]),
+			PrevOutIndex: 0,
+			PublicKey:    devKey.Public().Bytes(),
+		}},
+		Outputs: []*proto.TxOutput{{
+			Amount:  1_000_000,
+			Address: crypto.GeneratePrivateKey().Public().Address().Bytes(),
+		}},
+	}
+	signTransaction(devKey, tx)
+	assert.NoError(t, chain.ValidateTransaction(tx))
+}
+
+func TestLoadGenesis(t *testing.T) {
+	var (
+		validator = crypto.GeneratePrivateKey().Public()
+		address   = crypto.GeneratePrivateKey().Public().Address()
+		path      = filepath.Join(t.TempDir(), "genesis.json")
+	)
+
+	genesis := &Genesis{
+		ChainID:    "testnet",
+		Timestamp:  1,
+		Validators: []string{hex.EncodeToString(validator.Bytes())},
+		Alloc:      []GenesisAlloc{{Address: address.String(), Amount: 100}},
+	}
+	b, err := json.Marshal(genesis)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, b, 0644))
+
+	loaded, err := LoadGenesis(path)
+	require.NoError(t, err)
+	assert.Equal(t, genesis, loaded)
+
+	genesis.Alloc[0].Amount = -1
+	b, err = json.Marshal(genesis)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, b, 0644))
+	_, err = LoadGenesis(path)
+	assert.Error(t, err)
+}
+
+func TestRebuildChainWithOtherGenesis(t *testing.T) {
+	store, err := NewDiskBlockStore(t.TempDir())
+	require.NoError(t, err)
+	defer store.Close()
+
+	_, err = NewChain(store, DefaultGenesis())
+	require.NoError(t, err)
+
+	genesis := DefaultGenesis()
+	genesis.ChainID = "other"
+	_, err = NewChain(store, genesis)
+	assert.Error(t, err)
+}
+
+func TestGenesisWithoutValidators(t *testing.T) {
+	genesis := DefaultGenesis()
+	genesis.Validators = nil
+	_, err := NewChain(NewMemoryBlockStore(), genesis)
+	assert.Error(t, err)
+}
+
+func TestLegacyGenesisAllocIsSpendable(t *testing.T) {
+	var (
+		devKey  = crypto.NewPrivateKeyFromString(DevSeed)
+		other   = crypto.GeneratePrivateKey()
+		genesis = DefaultGenesis()
+	)
+	genesis.Alloc = []GenesisAlloc{{Address: devKey.Public().LegacyAddress().String(), Amount: 100}}
+	chain, err := NewChain(NewMemoryBlockStore(), genesis)
+	require.NoError(t, err)
+
+	block, err := chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+	spend := func(key *crypto.PrivateKey) *proto.Transaction {
+		tx := &proto.Transaction{
+			Version: 1,
+			Inputs: []*proto.TxInput{{
+				PrevTxHash: types.HashTransaction(block.Transactions[0]),
+				PublicKey:  key.Public().Bytes(),
+			}},
+			Outputs: []*proto.TxOutput{{
+				Amount:  100,
+				Address: devKey.Public().Address().Bytes(),
+			}},
+		}
+		signTransaction(key, tx)
+		return tx
+	}
+	assert.NoError(t, chain.ValidateTransaction(spend(devKey)))
+	err = chain.ValidateTransaction(spend(other))
+	assert.ErrorIs(t, err, ErrInvalidTransaction)
+	assert.ErrorContains(t, err, other.Public().Address().Encode(crypto.MainNetPrefix))
+
+	// Accounts are only reachable through versioned addresses.
+	genesis = DefaultGenesis()
+	genesis.Accounts[0].Address = devKey.Public().LegacyAddress().String()
+	assert.Error(t, genesis.Validate())
+}
+
+func TestGenesisEncodedAddresses(t *testing.T) {
+	var (
+		devKey  = crypto.NewPrivateKeyFromString(DevSeed)
+		address = devKey.Public().Address()
+		genesis = DefaultGenesis()
+	)
+	genesis.Alloc[0].Address = address.Encode(crypto.MainNetPrefix)
+	genesis.Accounts[0].Address = address.Encode(crypto.TestNetPrefix)
+	require.NoError(t, genesis.Validate())
+
+	// The encoding of the addresses doesn't change the genesis block.
+	block, err := genesis.Block()
+	require.NoError(t, err)
+	expected, err := DefaultGenesis().Block()
+	require.NoError(t, err)
+	assert.Equal(t, types.HashBlock(expected), types.HashBlock(block))
+	assert.Equal(t, DefaultGenesis().accounts(), genesis.accounts())
+
+	// The same account can't be funded twice in different encodings.
+	genesis.Accounts = append(genesis.Accounts, GenesisAlloc{Address: address.String(), Amount: 1})
+	assert.Error(t, genesis.Validate())
+
+	genesis = DefaultGenesis()
+	genesis.Alloc[0].Address = "bv1notanaddress"
+	assert.Error(t, genesis.Validate())
+}
@@ -0,0 +1,360 @@
+package node
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/types"
+	pb "google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrTxKnown     = errors.New("transaction already in mempool")
+	ErrTxConflict  = errors.New("transaction conflicts with mempool")
+	ErrMemPoolFull = errors.New("mempool full, fee rate too low")
+)
+
+// mempoolTx is a transaction waiting in the mempool together with the fee it
+// pays.
+type mempoolTx struct {
+	tx      *proto.Transaction
+	hash    string
+	fee     int64
+	size    int
+	feeRate float64
+	// seq is the order in which the transactions were added, used to break
+	// ties between transactions paying the same fee rate.
+	seq   uint64
+	added time.Time
+}
+
+// before reports whether tx takes priority over other.
+func (tx *mempoolTx) before(other *mempoolTx) bool {
+	if tx.feeRate != other.feeRate {
+		return tx.feeRate > other.feeRate
+	}
+	return tx.seq < other.seq
+}
+
+type MemPoolConfig struct {
+	// MaxTxx is the maximum number of transactions in the pool.
+	MaxTxx int
+	// MaxBytes is the maximum total size of the transactions in the pool.
+	MaxBytes int
+	// TTL is how long a transaction may wait in the pool before it expires.
+	TTL time.Duration
+}
+
+func DefaultMemPoolConfig() MemPoolConfig {
+	return MemPoolConfig{
+		MaxTxx:   10_000,
+		MaxBytes: 32 << 20,
+		TTL:      time.Hour,
+	}
+}
+
+// MemPool holds the valid transactions that are not yet part of a block,
+// ordered by the fee they pay per byte. When the pool is full the
+// transactions with the lowest fee rate are evicted first.
+type MemPool struct {
+	lock sync.RWMutex
+	cfg  MemPoolConfig
+	txx  map[string]*mempoolTx
+	// byFeeRate holds the transactions sorted from the highest to the lowest
+	// fee rate.
+	byFeeRate []*mempoolTx
+	// spent maps the outputs and account nonces spent by the transactions in
+	// the pool to the hash of the spending transaction.
+	spent map[string]string
+	seq   uint64
+	// bytes is the total size of the transactions in the pool.
+	bytes int
+	now   func() time.Time
+}
+
+// NewMemPool creates a pool with the given limits. Limits that are not set
+// are taken from the DefaultMemPoolConfig.
+func NewMemPool(cfg MemPoolConfig) *MemPool {
+	defaults := DefaultMemPoolConfig()
+	if cfg.MaxTxx <= 0 {
+		cfg.MaxTxx = defaults.MaxTxx
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaults.MaxBytes
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaults.TTL
+	}
+
+	return &MemPool{
+		cfg:   cfg,
+		txx:   make(map[string]*mempoolTx),
+		spent: make(map[string]string),
+		now:   time.Now,
+	}
+}
+
+// accountNonce identifies an account transaction by the public key of its
+// sender and its nonce.
+type accountNonce struct {
+	from  string
+	nonce uint64
+}
+
+// Pending returns up to limit transactions with the highest fee rate first.
+// The transactions of an account are returned in the order of their nonces,
+// so a block can include them in that order. The transactions stay in the
+// pool until they are removed.
+func (pool *MemPool) Pending(limit int) []*proto.Transaction {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+
+	// next is the nonce of the next transaction of every account, starting
+	// with its lowest nonce in the pool.
+	next := make(map[string]uint64)
+	for _, mtx := range pool.txx {
+		if types.IsAccountTransaction(mtx.tx) {
+			from, nonce := string(mtx.tx.Account.From), mtx.tx.Account.Nonce
+			if n, ok := next[from]; !ok || nonce < n {
+				next[from] = nonce
+			}
+		}
+	}
+
+	var (
+		txx = make([]*proto.Transaction, 0, min(limit, len(pool.byFeeRate)))
+		// waiting holds the account transactions that come before their
+		// preceding nonce by fee rate.
+		waiting = make(map[accountNonce]*proto.Transaction)
+	)
+	for _, mtx := range pool.byFeeRate {
+		if len(txx) >= limit {
+			break
+		}
+		if !types.IsAccountTransaction(mtx.tx) {
+			txx = append(txx, mtx.tx)
+			continue
+		}
+
+		from, nonce := string(mtx.tx.Account.From), mtx.tx.Account.Nonce
+		if nonce != next[from] {
+			waiting[accountNonce{from, nonce}] = mtx.tx
+			continue
+		}
+		// Take the transaction and the waiting ones of the account that
+		// follow it.
+		for tx := mtx.tx; tx != nil && len(txx) < limit; tx = waiting[accountNonce{from, next[from]}] {
+			txx = append(txx, tx)
+			next[from]++
+		}
+	}
+	return txx
+}
+
+// AccountTransactions returns the transactions in the pool sent from the
+// account with the public key, in the order of their nonces.
+func (pool *MemPool) AccountTransactions(from []byte) []*proto.Transaction {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+
+	var txx []*proto.Transaction
+	for _, mtx := range pool.txx {
+		if types.IsAccountTransaction(mtx.tx) && bytes.Equal(mtx.tx.Account.From, from) {
+			txx = append(txx, mtx.tx)
+		}
+	}
+	sort.Slice(txx, func(i, j int) bool {
+		return txx[i].Account.Nonce < txx[j].Account.Nonce
+	})
+	return txx
+}
+
+func (pool *MemPool) Len() int {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+	return len(pool.txx)
+}
+
+func (pool *MemPool) Has(tx *proto.Transaction) bool {
+	pool.lock.RLock()
+	defer pool.lock.RUnlock()
+	hash := hex.EncodeToString(types.HashTransaction(tx))
+	_, ok := pool.txx[hash]
+	return ok
+}
+
+func (pool *MemPool) Remove(tx *proto.Transaction) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	hash := hex.EncodeToString(types.HashTransaction(tx))
+	if mtx, ok := pool.txx[hash]; ok {
+		pool.remove(mtx)
+	}
+}
+
+// RemoveBlock removes the transactions of the block from the pool, together
+// with the transactions that spend the same outputs, which can no longer make
+// it into a block.
+func (pool *MemPool) RemoveBlock(b *proto.Block) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	for _, tx := range b.Transactions {
+		hash := hex.EncodeToString(types.HashTransaction(tx))
+		if mtx, ok := pool.txx[hash]; ok {
+			pool.remove(mtx)
+		}
+		for _, key := range spentKeys(tx) {
+			if hash, ok := pool.spent[key]; ok {
+				pool.remove(pool.txx[hash])
+			}
+		}
+	}
+}
+
+// RemoveInvalid removes the transactions for which validate returns an error
+// and returns how many were removed. validate gets all the transactions at
+// once, the ones of an account in the order of their nonces, and returns the
+// error of each of them.
+func (pool *MemPool) RemoveInvalid(validate func([]*proto.Transaction) []error) int {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	var mtxx, accountTxx []*mempoolTx
+	for _, mtx := range pool.byFeeRate {
+		if types.IsAccountTransaction(mtx.tx) {
+			accountTxx = append(accountTxx, mtx)
+		} else {
+			mtxx = append(mtxx, mtx)
+		}
+	}
+	sort.SliceStable(accountTxx, func(i, j int) bool {
+		return accountTxx[i].tx.Account.Nonce < accountTxx[j].tx.Account.Nonce
+	})
+	mtxx = append(mtxx, accountTxx...)
+
+	txx := make([]*proto.Transaction, len(mtxx))
+	for i, mtx := range mtxx {
+		txx[i] = mtx.tx
+	}
+
+	removed := 0
+	for i, err := range validate(txx) {
+		if err != nil {
+			pool.remove(mtxx[i])
+			removed++
+		}
+	}
+	return removed
+}
+
+// Expire removes the transactions that waited in the pool for longer than
+// the TTL and returns how many were removed.
+func (pool *MemPool) Expire() int {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	var (
+		deadline = pool.now().Add(-pool.cfg.TTL)
+		removed  = 0
+	)
+	for _, mtx := range pool.txx {
+		if mtx.added.Before(deadline) {
+			pool.remove(mtx)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Add adds the transaction paying the given fee to the pool. It fails if the
+// transaction is already in the pool, spends an output that is already spent
+// by another transaction in the pool, or pays a fee rate too low to stay in
+// the full pool.
+func (pool *MemPool) Add(tx *proto.Transaction, fee int64) error {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	hash := hex.EncodeToString(types.HashTransaction(tx))
+	if _, ok := pool.txx[hash]; ok {
+		return ErrTxKnown
+	}
+	for _, key := range spentKeys(tx) {
+		if other, ok := pool.spent[key]; ok {
+			return fmt.Errorf("%w: [%s] is spent by tx [%s]", ErrTxConflict, key, other)
+		}
+	}
+
+	size := pb.Size(tx)
+	pool.seq++
+	mtx := &mempoolTx{
+		tx:      tx,
+		hash:    hash,
+		fee:     fee,
+		size:    size,
+		feeRate: float64(fee) / float64(size),
+		seq:     pool.seq,
+		added:   pool.now(),
+	}
+
+	pool.txx[hash] = mtx
+	for _, key := range spentKeys(tx) {
+		pool.spent[key] = hash
+	}
+	i := pool.search(mtx)
+	pool.byFeeRate = append(pool.byFeeRate, nil)
+	copy(pool.byFeeRate[i+1:], pool.byFeeRate[i:])
+	pool.byFeeRate[i] = mtx
+	pool.bytes += size
+
+	// Make room by evicting the transactions with the lowest fee rate, which
+	// could be the one we just added.
+	for len(pool.txx) > pool.cfg.MaxTxx || pool.bytes > pool.cfg.MaxBytes {
+		lowest := pool.byFeeRate[len(pool.byFeeRate)-1]
+		pool.remove(lowest)
+		if lowest == mtx {
+			return ErrMemPoolFull
+		}
+	}
+	return nil
+}
+
+func (pool *MemPool) remove(mtx *mempoolTx) {
+	delete(pool.txx, mtx.hash)
+	pool.bytes -= mtx.size
+	for _, key := range spentKeys(mtx.tx) {
+		delete(pool.spent, key)
+	}
+	i := pool.search(mtx)
+	pool.byFeeRate = append(pool.byFeeRate[:i], pool.byFeeRate[i+1:]...)
+}
+
+// search returns the position of mtx in byFeeRate, or the position it has to
+// be inserted at.
+func (pool *MemPool) search(mtx *mempoolTx) int {
+	return sort.Search(len(pool.byFeeRate), func(i int) bool {
+		return !pool.byFeeRate[i].before(mtx)
+	})
+}
+
+// spentKeys returns the keys of the outputs spent by the transaction. An
+// account transaction spends the nonce of its sender instead, so only one
+// transaction per nonce is kept.
+func spentKeys(tx *proto.Transaction) []string {
+	if types.IsAccountTransaction(tx) {
+		return []string{fmt.Sprintf("account_%s_%d", hex.EncodeToString(tx.Account.From), tx.Account.Nonce)}
+	}
+
+	keys := make([]string, len(tx.Inputs))
+	for i, input := range tx.Inputs {
+		keys[i] = utxoKey(hex.EncodeToString(input.PrevTxHash), int(input.PrevOutIndex))
+	}
+	return keys
+}
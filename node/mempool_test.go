@@ -0,0 +1,171 @@
+package node
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/util"
+	pb "google.golang.org/protobuf/proto"
+)
+
+// randomTx returns a transaction spending a random output.
+func randomTx() *proto.Transaction {
+	return &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash: util.RandomHash(),
+		}},
+		Outputs: []*proto.TxOutput{{
+			Amount:  100,
+			Address: util.RandomHash()[:20],
+		}},
+	}
+}
+
+func TestMemPoolPendingByFeeRate(t *testing.T) {
+	var (
+		pool = NewMemPool(DefaultMemPoolConfig())
+		low  = randomTx()
+		mid  = randomTx()
+		high = randomTx()
+	)
+	assert.NoError(t, pool.Add(low, 1))
+	assert.NoError(t, pool.Add(high, 100))
+	assert.NoError(t, pool.Add(mid, 10))
+	assert.ErrorIs(t, pool.Add(mid, 10), ErrTxKnown)
+	assert.Equal(t, 3, pool.Len())
+
+	assert.Equal(t, []*proto.Transaction{high, mid, low}, pool.Pending(10))
+
+	// Transactions not picked for the block stay in the pool.
+	assert.Equal(t, []*proto.Transaction{high, mid}, pool.Pending(2))
+	assert.Equal(t, 3, pool.Len())
+
+	pool.Remove(high)
+	assert.False(t, pool.Has(high))
+	assert.Equal(t, []*proto.Transaction{mid, low}, pool.Pending(10))
+}
+
+func TestMemPoolFeeRateUsesSize(t *testing.T) {
+	var (
+		pool  = NewMemPool(DefaultMemPoolConfig())
+		small = randomTx()
+		large = randomTx()
+	)
+	for i := 0; i < 10; i++ {
+		large.Outputs = append(large.Outputs, &proto.TxOutput{Amount: 1, Address: util.RandomHash()[:20]})
+	}
+
+	// The large transaction pays a higher fee but a lower fee per byte.
+	assert.NoError(t, pool.Add(large, 20))
+	assert.NoError(t, pool.Add(small, 10))
+	assert.Equal(t, []*proto.Transaction{small, large}, pool.Pending(2))
+}
+
+func TestMemPoolRejectsConflicts(t *testing.T) {
+	pool := NewMemPool(DefaultMemPoolConfig())
+	tx := randomTx()
+	assert.NoError(t, pool.Add(tx, 1))
+
+	conflicting := randomTx()
+	conflicting.Inputs = tx.Inputs
+	assert.ErrorIs(t, pool.Add(conflicting, 100), ErrTxConflict)
+
+	// Once the first transaction is gone the output can be spent again.
+	pool.Remove(tx)
+	assert.NoError(t, pool.Add(conflicting, 100))
+}
+
+func TestMemPoolEvictsLowestFeeRate(t *testing.T) {
+	pool := NewMemPool(MemPoolConfig{MaxTxx: 2})
+	var (
+		low  = randomTx()
+		mid  = randomTx()
+		high = randomTx()
+	)
+	assert.NoError(t, pool.Add(mid, 10))
+	assert.NoError(t, pool.Add(low, 1))
+	assert.NoError(t, pool.Add(high, 100))
+	assert.Equal(t, 2, pool.Len())
+	assert.False(t, pool.Has(low))
+
+	// A transaction paying less than everything in the full pool is rejected.
+	assert.ErrorIs(t, pool.Add(randomTx(), 0), ErrMemPoolFull)
+	assert.Equal(t, []*proto.Transaction{high, mid}, pool.Pending(10))
+}
+
+func TestMemPoolMaxBytes(t *testing.T) {
+	tx := randomTx()
+	pool := NewMemPool(MemPoolConfig{MaxBytes: pb.Size(tx) * 2})
+	assert.NoError(t, pool.Add(tx, 1))
+	assert.NoError(t, pool.Add(randomTx(), 2))
+	assert.NoError(t, pool.Add(randomTx(), 3))
+	assert.Equal(t, 2, pool.Len())
+	assert.False(t, pool.Has(tx))
+}
+
+func TestMemPoolExpire(t *testing.T) {
+	var (
+		pool = NewMemPool(MemPoolConfig{TTL: time.Minute})
+		now  = time.Now()
+		old  = randomTx()
+		tx   = randomTx()
+	)
+	pool.now = func() time.Time { return now }
+	assert.NoError(t, pool.Add(old, 1))
+
+	now = now.Add(time.Second * 30)
+	assert.NoError(t, pool.Add(tx, 1))
+	assert.Equal(t, 0, pool.Expire())
+
+	now = now.Add(time.Second * 31)
+	assert.Equal(t, 1, pool.Expire())
+	assert.False(t, pool.Has(old))
+	assert.True(t, pool.Has(tx))
+}
+
+func TestMemPoolRemoveBlock(t *testing.T) {
+	var (
+		pool        = NewMemPool(DefaultMemPoolConfig())
+		included    = randomTx()
+		conflicting = randomTx()
+		unrelated   = randomTx()
+	)
+	assert.NoError(t, pool.Add(included, 1))
+	assert.NoError(t, pool.Add(unrelated, 1))
+
+	// The block spends the output of conflicting with another transaction.
+	assert.NoError(t, pool.Add(conflicting, 1))
+	spender := randomTx()
+	spender.Inputs = conflicting.Inputs
+
+	pool.RemoveBlock(&proto.Block{
+		Transactions: []*proto.Transaction{included, spender},
+	})
+	assert.Equal(t, []*proto.Transaction{unrelated}, pool.Pending(10))
+}
+
+func TestMemPoolRemoveInvalid(t *testing.T) {
+	var (
+		pool    = NewMemPool(DefaultMemPoolConfig())
+		valid   = randomTx()
+		invalid = randomTx()
+	)
+	assert.NoError(t, pool.Add(valid, 1))
+	assert.NoError(t, pool.Add(invalid, 1))
+
+	removed := pool.RemoveInvalid(func(txx []*proto.Transaction) []error {
+		errs := make([]error, len(txx))
+		for i, tx := range txx {
+			if tx == invalid {
+				errs[i] = fmt.Errorf("invalid")
+			}
+		}
+		return errs
+	})
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, []*proto.Transaction{valid}, pool.Pending(10))
+}
@@ -1,8 +1,12 @@
 package node
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"sync"
 	"time"
@@ -12,68 +16,37 @@ import (
 	"github.com/vlayco/blockverse/types"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
-const blockTime = time.Second * 5
-
-type MemPool struct {
-	lock sync.RWMutex
-	txx  map[string]*proto.Transaction
-}
-
-func NewMemPool() *MemPool {
-	return &MemPool{
-		txx: make(map[string]*proto.Transaction),
-	}
-}
-
-func (pool *MemPool) Clear() []*proto.Transaction {
-	pool.lock.RLock()
-	defer pool.lock.RUnlock()
-
-	txx := make([]*proto.Transaction, pool.Len())
-	it := 0
-	for k, v := range pool.txx {
-		delete(pool.txx, k)
-		txx[it] = v
-		it++
-	}
-	return txx
-}
-
-func (pool *MemPool) Len() int {
-	pool.lock.RLock()
-	defer pool.lock.RUnlock()
-	return len(pool.txx)
-}
-
-func (pool *MemPool) Has(tx *proto.Transaction) bool {
-	pool.lock.RLock()
-	defer pool.lock.RUnlock()
-	hash := hex.EncodeToString(types.HashTransaction(tx))
-	_, ok := pool.txx[hash]
-	return ok
-}
-
-func (pool *MemPool) Add(tx *proto.Transaction) bool {
-	if pool.Has(tx) {
-		return false
-	}
-
-	pool.lock.Lock()
-	defer pool.lock.Unlock()
-
-	hash := hex.EncodeToString(types.HashTransaction(tx))
-	pool.txx[hash] = tx
-	return true
-}
+const (
+	blockTime = time.Second * 5
+	// maxBlockTxx is the maximum number of transactions in a block, not
+	// counting the coinbase.
+	maxBlockTxx = 1000
+	// mempoolExpiryInterval is how often expired transactions are removed
+	// from the mempool.
+	mempoolExpiryInterval = time.Minute
+)
 
 type ServerConfig struct {
 	Version    string
 	ListenAddr string
 	PrivateKey *crypto.PrivateKey
+	// KeystoreFile is an encrypted keystore file the PrivateKey is loaded
+	// from with the KeystorePassphrase when the node is created.
+	KeystoreFile       string
+	KeystorePassphrase string
+	// DataDir is the directory the blocks are persisted in. If empty the
+	// blocks are only kept in memory.
+	DataDir string
+	MemPool MemPoolConfig
+	// Genesis specifies the first block of the chain. If nil the
+	// DefaultGenesis is used.
+	Genesis *Genesis
 }
 
 type Node struct {
@@ -84,11 +57,19 @@ type Node struct {
 	peerLock sync.RWMutex
 	peers    map[proto.NodeClient]*proto.Version
 	mempool  *MemPool
+	chain    *Chain
+	// syncing is set while we are fetching missing blocks. Requests to sync
+	// made meanwhile are kept in syncHeight and syncPeer, and handled once
+	// the running sync finishes. A nil syncPeer means any peer.
+	syncLock   sync.Mutex
+	syncing    bool
+	syncHeight int32
+	syncPeer   proto.NodeClient
 
 	proto.UnimplementedNodeServer
 }
 
-func NewNode(cfg ServerConfig) *Node {
+func NewNode(cfg ServerConfig) (*Node, error) {
 	// loggerConfig := zap.NewProductionConfig()
 	loggerConfig := zap.NewDevelopmentConfig()
 	// loggerConfig.EncoderConfig.TimeKey = "timestamp"
@@ -96,12 +77,47 @@ func NewNode(cfg ServerConfig) *Node {
 	loggerConfig.Level.SetLevel(zap.DebugLevel)
 	// loggerConfig.EncoderConfig.EncodeTime = zapcore.TimeEncoderOfLayout(time.RFC3339)
 	logger, _ := loggerConfig.Build()
-	return &Node{
+
+	if cfg.KeystoreFile != "" {
+		if cfg.PrivateKey != nil {
+			return nil, fmt.Errorf("both a private key and a keystore file are configured")
+		}
+		privKey, err := crypto.LoadKeystore(cfg.KeystoreFile, cfg.KeystorePassphrase)
+		if err != nil {
+			return nil, err
+		}
+		cfg.PrivateKey = privKey
+	}
+
+	var blockStore BlockStorer = NewMemoryBlockStore()
+	if cfg.DataDir != "" {
+		diskStore, err := NewDiskBlockStore(cfg.DataDir)
+		if err != nil {
+			return nil, err
+		}
+		blockStore = diskStore
+	}
+
+	genesis := cfg.Genesis
+	if genesis == nil {
+		genesis = DefaultGenesis()
+	}
+
+	chain, err := NewChain(blockStore, genesis)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Node{
 		peers:        make(map[proto.NodeClient]*proto.Version),
 		logger:       logger.Sugar(),
-		mempool:      NewMemPool(),
+		mempool:      NewMemPool(cfg.MemPool),
+		chain:        chain,
 		ServerConfig: cfg,
 	}
+	chain.OnUpdate(n.handleChainUpdate)
+
+	return n, nil
 }
 
 func (n *Node) Start(listenAddr string, bootstrapNodes []string) error {
@@ -126,13 +142,24 @@ func (n *Node) Start(listenAddr string, bootstrapNodes []string) error {
 		go n.bootstrapNetwork(bootstrapNodes)
 	}
 
+	go n.mempoolLoop()
+
 	if n.PrivateKey != nil {
-		go n.validatorLoop()
+		if n.chain.IsValidator(n.PrivateKey.Public().Bytes()) {
+			go n.validatorLoop()
+		} else {
+			n.logger.Warnw("private key is not part of the validator set", "pubkey", n.PrivateKey.Public())
+		}
 	}
 
 	return grpcServer.Serve(ln)
 }
 
+// Chain returns the chain of the node.
+func (n *Node) Chain() *Chain {
+	return n.chain
+}
+
 func (n *Node) Handshake(ctx context.Context, v *proto.Version) (*proto.Version, error) {
 	c, err := makeNodeClient(v.ListenAddr)
 	if err != nil {
@@ -148,41 +175,383 @@ func (n *Node) HandleTransaction(ctx context.Context, tx *proto.Transaction) (*p
 	peer, _ := peer.FromContext(ctx)
 	hash := hex.EncodeToString(types.HashTransaction(tx))
 
-	if n.mempool.Add(tx) {
-		n.logger.Debugw("received tx", "from", peer.Addr, "hash", hash, "we", n.ListenAddr)
-		go func() {
-			if err := n.broadcast(tx); err != nil {
-				n.logger.Errorw("broadcast error", "err", err)
-			}
-		}()
+	// We have already seen this transaction, so there is no need to gossip
+	// it again.
+	if n.mempool.Has(tx) {
+		return &proto.Ack{}, nil
+	}
+
+	fee, err := n.transactionFee(tx)
+	if err == nil {
+		err = n.mempool.Add(tx, fee)
+	}
+	if errors.Is(err, ErrTxKnown) {
+		return &proto.Ack{}, nil
+	}
+	if err != nil {
+		n.logger.Debugw("rejected tx", "from", peer.Addr, "hash", hash, "err", err)
+		return nil, txStatusError(err)
+	}
+
+	n.logger.Debugw("received tx", "from", peer.Addr, "hash", hash, "we", n.ListenAddr)
+	go func() {
+		if err := n.broadcast(tx); err != nil {
+			n.logger.Errorw("broadcast error", "err", err)
+		}
+	}()
+
+	return &proto.Ack{}, nil
+}
+
+// txStatusError converts the reason a transaction was rejected into a gRPC
+// status error.
+func txStatusError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, ErrInvalidTransaction):
+		code = codes.InvalidArgument
+	case errors.Is(err, ErrMissingInput), errors.Is(err, ErrTxConflict), errors.Is(err, ErrTxLocked),
+		errors.Is(err, ErrInvalidNonce), errors.Is(err, ErrInsufficientBalance):
+		code = codes.FailedPrecondition
+	case errors.Is(err, ErrMemPoolFull):
+		code = codes.ResourceExhausted
+	}
+	return status.Error(code, err.Error())
+}
+
+func (n *Node) HandleBlock(ctx context.Context, b *proto.Block) (*proto.Ack, error) {
+	peer, _ := peer.FromContext(ctx)
+	hash := types.HashBlock(b)
+
+	// We have already seen this block, so there is no need to gossip it again.
+	if n.chain.HasBlock(hash) {
+		return &proto.Ack{}, nil
 	}
 
+	if err := n.addBlock(b); err != nil {
+		// We missed blocks before this one, so fetch them from our peers.
+		if errors.Is(err, ErrUnknownParent) {
+			go n.syncChain(nil, b.Header.Height)
+		}
+		return nil, err
+	}
+
+	n.logger.Debugw("received block",
+		"from", peer.Addr,
+		"hash", hex.EncodeToString(hash),
+		"height", b.Header.Height,
+		"we", n.ListenAddr)
+
+	go func() {
+		if err := n.broadcast(b); err != nil {
+			n.logger.Errorw("broadcast error", "err", err)
+		}
+	}()
+
 	return &proto.Ack{}, nil
 }
 
+func (n *Node) GetBlocks(req *proto.BlockRequest, stream proto.Node_GetBlocksServer) error {
+	if req.FromHeight < 0 || req.ToHeight < req.FromHeight {
+		return fmt.Errorf("invalid block range [%d, %d]", req.FromHeight, req.ToHeight)
+	}
+
+	for height := int(req.FromHeight); height <= int(req.ToHeight); height++ {
+		// We can't serve blocks we don't have yet.
+		if height > n.chain.Height() {
+			break
+		}
+		b, err := n.chain.GetBlockByHeight(height)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncChain fetches the blocks between our height and the given height of
+// the peer, or of any of our peers if c is nil, and adds them to our chain in
+// order. Only one sync runs at a time; a request made while it runs is
+// handled after it, unless an earlier request is further ahead. When there
+// are no requests left, we sync with the best known peer if it is ahead.
+func (n *Node) syncChain(c proto.NodeClient, height int32) {
+	n.syncLock.Lock()
+	if height > n.syncHeight {
+		n.syncHeight, n.syncPeer = height, c
+	}
+	if n.syncing {
+		n.syncLock.Unlock()
+		return
+	}
+	n.syncing = true
+	n.syncLock.Unlock()
+
+	// tried is the highest height we tried to sync to, so we don't keep
+	// retrying a peer that fails to give us its blocks.
+	var tried int32
+	for {
+		n.syncLock.Lock()
+		c, height := n.syncPeer, n.syncHeight
+		n.syncPeer, n.syncHeight = nil, 0
+		if int(height) <= n.chain.Height() {
+			c, height = n.bestPeer()
+		}
+		if int(height) <= n.chain.Height() || height <= tried {
+			n.syncing = false
+			n.syncLock.Unlock()
+			return
+		}
+		n.syncLock.Unlock()
+		tried = height
+
+		peers := []proto.NodeClient{c}
+		if c == nil {
+			peers = n.getPeers()
+		}
+		for _, peer := range peers {
+			if n.syncWith(peer, height) {
+				break
+			}
+		}
+	}
+}
+
+// syncWith fetches the blocks up to the height from the peer and reports
+// whether it succeeded.
+func (n *Node) syncWith(c proto.NodeClient, height int32) bool {
+	var (
+		from = n.chain.Height() + 1
+		step = 1
+	)
+	for {
+		n.logger.Debugw("syncing chain", "we", n.ListenAddr, "from", from, "to", height)
+
+		err := n.fetchBlocks(c, int32(from), height)
+		if err == nil {
+			break
+		}
+		// The chain of the peer forked from ours below our tip, so go
+		// back further until we reach the blocks we have in common.
+		if !errors.Is(err, ErrUnknownParent) || from == 1 {
+			n.logger.Errorw("sync error", "err", err)
+			return false
+		}
+		from = max(1, n.chain.Height()+1-step)
+		step *= 2
+	}
+
+	n.logger.Debugw("chain synced", "we", n.ListenAddr, "height", n.chain.Height())
+	return true
+}
+
+func (n *Node) fetchBlocks(c proto.NodeClient, from, to int32) error {
+	stream, err := c.GetBlocks(context.Background(), &proto.BlockRequest{
+		FromHeight: from,
+		ToHeight:   to,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		b, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// The block could have reached us through gossip in the meantime.
+		if n.chain.HasBlock(types.HashBlock(b)) {
+			continue
+		}
+		if err := n.addBlock(b); err != nil {
+			return err
+		}
+	}
+}
+
+// addBlock adds the block to our chain. The mempool is updated by
+// handleChainUpdate once the block is part of the main chain.
+func (n *Node) addBlock(b *proto.Block) error {
+	return n.chain.AddBlock(b)
+}
+
+func (n *Node) mempoolLoop() {
+	ticker := time.NewTicker(mempoolExpiryInterval)
+	for {
+		<-ticker.C
+
+		if expired := n.mempool.Expire(); expired > 0 {
+			n.logger.Debugw("expired mempool txs", "we", n.ListenAddr, "count", expired)
+		}
+	}
+}
+
+// handleChainUpdate removes the transactions of the blocks added to the main
+// chain, and the ones conflicting with them, from the mempool. After a reorg
+// the transactions of the blocks that left the main chain move back into the
+// mempool, unless they are part of the new main chain or no longer valid on
+// top of it.
+func (n *Node) handleChainUpdate(disconnected, connected []*proto.Block) {
+	for _, b := range connected {
+		n.mempool.RemoveBlock(b)
+	}
+	if len(disconnected) == 0 {
+		return
+	}
+	// The disconnected blocks could have created outputs spent by
+	// transactions in the mempool.
+	n.mempool.RemoveInvalid(func(txx []*proto.Transaction) []error {
+		_, errs := n.chain.TransactionFees(txx)
+		return errs
+	})
+
+	orphaned := 0
+	for _, b := range disconnected {
+		for _, tx := range b.Transactions {
+			fee, err := n.transactionFee(tx)
+			if err != nil {
+				continue
+			}
+			if n.mempool.Add(tx, fee) == nil {
+				orphaned++
+			}
+		}
+	}
+
+	n.logger.Infow("chain reorganized",
+		"we", n.ListenAddr,
+		"disconnected", len(disconnected),
+		"connected", len(connected),
+		"orphanedTx", orphaned,
+		"height", n.chain.Height())
+}
+
 func (n *Node) validatorLoop() {
 	n.logger.Infow("starting validator loop", "pubkey", n.PrivateKey.Public(), "blockTime", blockTime)
 	ticker := time.NewTicker(blockTime)
 	for {
 		<-ticker.C
 
-		txx := n.mempool.Clear()
+		// Validators take turns, so we only propose a block when it's ours.
+		height := n.chain.Height() + 1
+		if !bytes.Equal(n.chain.Proposer(height), n.PrivateKey.Public().Bytes()) {
+			continue
+		}
+
+		// Transactions that don't fit into the block stay in the mempool
+		// for the next one.
+		txx := n.mempool.Pending(maxBlockTxx)
+
+		block, err := n.createBlock(txx)
+		if err != nil {
+			n.logger.Errorw("failed to create block", "err", err)
+			continue
+		}
+
+		if err := n.addBlock(block); err != nil {
+			n.logger.Errorw("failed to add block", "err", err)
+			continue
+		}
+
+		n.logger.Debugw("created new block",
+			"height", block.Header.Height,
+			"hash", hex.EncodeToString(types.HashBlock(block)),
+			"lenTx", len(txx))
+
+		go func() {
+			if err := n.broadcast(block); err != nil {
+				n.logger.Errorw("broadcast error", "err", err)
+			}
+		}()
+	}
+}
+
+// createBlock builds a block on top of our current chain containing the given
+// transactions and signs it with our private key. The block starts with the
+// coinbase transaction paying the block reward and the fees to us.
+// transactionFee validates the transaction like Chain.TransactionFee, but an
+// account transaction is validated after the transactions of its sender that
+// wait in the mempool, so it can use the next nonce.
+func (n *Node) transactionFee(tx *proto.Transaction) (int64, error) {
+	if !types.IsAccountTransaction(tx) {
+		return n.chain.TransactionFee(tx)
+	}
+	txx := append(n.mempool.AccountTransactions(tx.Account.From), tx)
+	fees, errs := n.chain.TransactionFees(txx)
+	return fees[len(txx)-1], errs[len(txx)-1]
+}
+
+func (n *Node) createBlock(txx []*proto.Transaction) (*proto.Block, error) {
+	prevBlock, err := n.chain.GetBlockByHeight(n.chain.Height())
+	if err != nil {
+		return nil, err
+	}
+	height := prevBlock.Header.Height + 1
 
-		n.logger.Debugw("time to create new block", "lenTx", len(txx))
+	var (
+		fees  int64
+		valid = []*proto.Transaction{}
+	)
+	// The transactions are checked in order on top of each other, so an
+	// account can send several of them in the block.
+	txFees, errs := n.chain.TransactionFees(txx)
+	for i, tx := range txx {
+		// Transactions can become invalid while they wait in the mempool,
+		// so they are dropped from it as well.
+		fee, err := txFees[i], errs[i]
+		if err != nil {
+			n.logger.Debugw("dropping invalid tx", "hash", hex.EncodeToString(types.HashTransaction(tx)), "err", err)
+			n.mempool.Remove(tx)
+			continue
+		}
+		fees += fee
+		valid = append(valid, tx)
 	}
+
+	coinbase := types.NewCoinbaseTransaction(height, n.PrivateKey.Public().Address().Bytes(), n.chain.BlockReward()+fees)
+	txx = append([]*proto.Transaction{coinbase}, valid...)
+
+	// Our clock may be behind the one of the previous proposer.
+	timestamp := max(time.Now().UnixNano(), prevBlock.Header.Timestamp+1)
+
+	block := &proto.Block{
+		Header: &proto.Header{
+			Version:   1,
+			Height:    height,
+			PrevHash:  types.HashBlock(prevBlock),
+			RootHash:  types.CalculateRootHash(txx),
+			Timestamp: timestamp,
+		},
+		Transactions: txx,
+	}
+	types.SignBlock(n.PrivateKey, block)
+
+	return block, nil
 }
 
+// broadcast sends the message to all our peers and returns the errors of the
+// peers that failed to handle it.
 func (n *Node) broadcast(msg any) error {
-	for peer := range n.peers {
+	var errs []error
+	for _, peer := range n.getPeers() {
+		var err error
 		switch v := msg.(type) {
 		case *proto.Transaction:
-			_, err := peer.HandleTransaction(context.Background(), v)
-			if err != nil {
-				return err
-			}
+			_, err = peer.HandleTransaction(context.Background(), v)
+		case *proto.Block:
+			_, err = peer.HandleBlock(context.Background(), v)
+		}
+		if err != nil {
+			errs = append(errs, err)
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 func (n *Node) addPeer(c proto.NodeClient, v *proto.Version) {
@@ -199,6 +568,11 @@ func (n *Node) addPeer(c proto.NodeClient, v *proto.Version) {
 		go n.bootstrapNetwork(v.PeerList)
 	}
 
+	// Fetch the blocks we are missing if the peer is ahead of us.
+	if int(v.Height) > n.chain.Height() {
+		go n.syncChain(c, v.Height)
+	}
+
 	n.logger.Debugw("new peer succesfully connected",
 		"we", n.ListenAddr,
 		"remote node", v.ListenAddr,
@@ -246,7 +620,7 @@ func (n *Node) dialRemoteNode(addr string) (proto.NodeClient, *proto.Version, er
 func (n *Node) getVersion() *proto.Version {
 	return &proto.Version{
 		Version:    "blockverse-0.1",
-		Height:     0,
+		Height:     int32(n.chain.Height()),
 		ListenAddr: n.ListenAddr,
 		PeerList:   n.getPeerList(),
 	}
@@ -269,6 +643,36 @@ func (n *Node) canConnectWith(addr string) bool {
 	return true
 }
 
+// getPeers returns a snapshot of the connected peers, so we don't hold the
+// lock while talking to them over the network.
+func (n *Node) getPeers() []proto.NodeClient {
+	n.peerLock.RLock()
+	defer n.peerLock.RUnlock()
+
+	peers := make([]proto.NodeClient, 0, len(n.peers))
+	for peer := range n.peers {
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// bestPeer returns the peer with the highest known chain and its height.
+func (n *Node) bestPeer() (proto.NodeClient, int32) {
+	n.peerLock.RLock()
+	defer n.peerLock.RUnlock()
+
+	var (
+		best   proto.NodeClient
+		height int32
+	)
+	for peer, v := range n.peers {
+		if v.Height > height {
+			best, height = peer, v.Height
+		}
+	}
+	return best, height
+}
+
 // Converts map to a slice of peers.
 func (n *Node) getPeerList() []string {
 	n.peerLock.RLock()
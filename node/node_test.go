@@ -0,0 +1,301 @@
+package node
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/types"
+	"github.com/vlayco/blockverse/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// startNode starts a node on a free local port and returns it together with
+// its listen address.
+func startNode(t *testing.T, cfg ServerConfig, bootstrapNodes []string) (*Node, string) {
+	n, err := NewNode(cfg)
+	require.NoError(t, err)
+
+	addr := freeAddr(t)
+	go n.Start(addr, bootstrapNodes)
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	}, time.Second*5, time.Millisecond*10)
+
+	return n, addr
+}
+
+// countingClient counts the blocks sent to a peer.
+type countingClient struct {
+	proto.NodeClient
+	blocks *atomic.Int32
+}
+
+func (c countingClient) HandleBlock(ctx context.Context, b *proto.Block, opts ...grpc.CallOption) (*proto.Ack, error) {
+	c.blocks.Add(1)
+	return c.NodeClient.HandleBlock(ctx, b, opts...)
+}
+
+func TestBlockGossip(t *testing.T) {
+	a, aAddr := startNode(t, ServerConfig{Version: "blockverse-1"}, nil)
+	b, _ := startNode(t, ServerConfig{Version: "blockverse-1"}, []string{aAddr})
+	require.Eventually(t, func() bool {
+		return len(a.getPeers()) == 1
+	}, time.Second*5, time.Millisecond*10)
+	c, _ := startNode(t, ServerConfig{Version: "blockverse-1"}, []string{aAddr})
+	nodes := []*Node{a, b, c}
+
+	// Wait until every node is connected to the two others, c learns about
+	// b from the peer list of a.
+	require.Eventually(t, func() bool {
+		for _, n := range nodes {
+			if len(n.getPeers()) != 2 {
+				return false
+			}
+		}
+		return true
+	}, time.Second*5, time.Millisecond*10)
+
+	var sent atomic.Int32
+	for _, n := range nodes {
+		n.peerLock.Lock()
+		peers := make(map[proto.NodeClient]*proto.Version, len(n.peers))
+		for peer, v := range n.peers {
+			peers[countingClient{NodeClient: peer, blocks: &sent}] = v
+		}
+		n.peers = peers
+		n.peerLock.Unlock()
+	}
+
+	genesis, err := a.chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+	block := childBlock(t, genesis)
+	client, err := makeNodeClient(aAddr)
+	require.NoError(t, err)
+	_, err = client.HandleBlock(context.Background(), block)
+	require.NoError(t, err)
+
+	// The block reaches every node.
+	require.Eventually(t, func() bool {
+		for _, n := range nodes {
+			if n.chain.Height() != 1 {
+				return false
+			}
+		}
+		return true
+	}, time.Second*5, time.Millisecond*10)
+	for _, n := range nodes {
+		assert.True(t, n.chain.HasBlock(types.HashBlock(block)))
+	}
+
+	// Every node forwards the block to its two peers once; the nodes that
+	// already have it don't gossip it again.
+	require.Eventually(t, func() bool {
+		return sent.Load() == 6
+	}, time.Second*5, time.Millisecond*10)
+	time.Sleep(time.Millisecond * 200)
+	assert.Equal(t, int32(6), sent.Load())
+}
+
+func TestSyncChain(t *testing.T) {
+	ahead, aheadAddr := startNode(t, ServerConfig{Version: "blockverse-1"}, nil)
+	for i := 0; i < 20; i++ {
+		require.NoError(t, ahead.chain.AddBlock(randomBlock(t, ahead.chain)))
+	}
+
+	behind, _ := startNode(t, ServerConfig{Version: "blockverse-1"}, []string{aheadAddr})
+	require.Eventually(t, func() bool {
+		return behind.chain.Height() == ahead.chain.Height()
+	}, time.Second*5, time.Millisecond*10)
+
+	tip, err := ahead.chain.GetBlockByHeight(ahead.chain.Height())
+	require.NoError(t, err)
+	require.True(t, behind.chain.HasBlock(types.HashBlock(tip)))
+}
+
+func TestSyncOnUnknownParent(t *testing.T) {
+	ahead, aheadAddr := startNode(t, ServerConfig{Version: "blockverse-1"}, nil)
+	behind, _ := startNode(t, ServerConfig{Version: "blockverse-1"}, []string{aheadAddr})
+	require.Eventually(t, func() bool {
+		return len(behind.getPeers()) == 1
+	}, time.Second*5, time.Millisecond*10)
+
+	// The behind node misses the first block and only gets the second.
+	require.NoError(t, ahead.chain.AddBlock(randomBlock(t, ahead.chain)))
+	b := randomBlock(t, ahead.chain)
+	require.NoError(t, ahead.chain.AddBlock(b))
+
+	_, err := behind.HandleBlock(context.Background(), b)
+	require.ErrorIs(t, err, ErrUnknownParent)
+	require.Eventually(t, func() bool {
+		return behind.chain.HasBlock(types.HashBlock(b))
+	}, time.Second*5, time.Millisecond*10)
+	assert.Equal(t, 2, behind.chain.Height())
+}
+
+func TestHandleTransaction(t *testing.T) {
+	n, addr := startNode(t, ServerConfig{Version: "blockverse-1"}, nil)
+	c, err := makeNodeClient(addr)
+	require.NoError(t, err)
+
+	requireCode := func(code codes.Code, tx *proto.Transaction) {
+		t.Helper()
+		_, err := c.HandleTransaction(context.Background(), tx)
+		require.Error(t, err)
+		assert.Equal(t, code, status.Code(err), err)
+		assert.NotEmpty(t, status.Convert(err).Message())
+		assert.False(t, n.mempool.Has(tx))
+	}
+
+	// Malformed transactions.
+	requireCode(codes.InvalidArgument, &proto.Transaction{Version: 1})
+	requireCode(codes.InvalidArgument, coinbase(1, 0))
+
+	tx := spendGenesis(t, n.chain, 100)
+	tx.Outputs[0].Amount = -1
+	requireCode(codes.InvalidArgument, tx)
+
+	tx = spendGenesis(t, n.chain, 100)
+	tx.Inputs[0].Signature = util.RandomHash()
+	requireCode(codes.InvalidArgument, tx)
+
+	tx = spendGenesis(t, n.chain, 100)
+	tx.Inputs = append(tx.Inputs, tx.Inputs[0])
+	requireCode(codes.InvalidArgument, tx)
+
+	// Overspending.
+	requireCode(codes.InvalidArgument, spendGenesis(t, n.chain, 2_000_000))
+
+	// Spending an output that does not exist.
+	tx = spendGenesis(t, n.chain, 100)
+	tx.Inputs[0].PrevTxHash = util.RandomHash()
+	signTransaction(validatorKey(), tx)
+	requireCode(codes.FailedPrecondition, tx)
+
+	// A transaction that is not final yet.
+	tx = spendGenesis(t, n.chain, 100)
+	tx.LockHeight = 10
+	signTransaction(validatorKey(), tx)
+	requireCode(codes.FailedPrecondition, tx)
+
+	// A valid transaction is accepted, also when it's received again.
+	tx = spendGenesis(t, n.chain, 100)
+	_, err = c.HandleTransaction(context.Background(), tx)
+	require.NoError(t, err)
+	assert.True(t, n.mempool.Has(tx))
+	_, err = c.HandleTransaction(context.Background(), tx)
+	require.NoError(t, err)
+
+	// Spending the same output as a transaction in the mempool.
+	requireCode(codes.FailedPrecondition, spendGenesis(t, n.chain, 99))
+}
+
+func TestNewNodeKeystore(t *testing.T) {
+	var (
+		privKey = crypto.GeneratePrivateKey()
+		path    = filepath.Join(t.TempDir(), "key.json")
+	)
+	require.NoError(t, crypto.SaveKeystore(path, privKey, "passphrase", crypto.LightScryptN))
+
+	n, err := NewNode(ServerConfig{KeystoreFile: path, KeystorePassphrase: "passphrase"})
+	require.NoError(t, err)
+	assert.Equal(t, privKey.Bytes(), n.PrivateKey.Bytes())
+
+	_, err = NewNode(ServerConfig{KeystoreFile: path, KeystorePassphrase: "wrong"})
+	assert.ErrorIs(t, err, crypto.ErrWrongPassphrase)
+
+	_, err = NewNode(ServerConfig{PrivateKey: privKey, KeystoreFile: path, KeystorePassphrase: "passphrase"})
+	assert.Error(t, err)
+}
+
+func TestSideBranchBlockKeepsMempool(t *testing.T) {
+	n, err := NewNode(ServerConfig{})
+	require.NoError(t, err)
+	genesis, err := n.chain.GetBlockByHeight(0)
+	require.NoError(t, err)
+
+	a1 := childBlock(t, genesis)
+	require.NoError(t, n.addBlock(a1))
+
+	tx := spendGenesis(t, n.chain, 100)
+	fee, err := n.chain.TransactionFee(tx)
+	require.NoError(t, err)
+	require.NoError(t, n.mempool.Add(tx, fee))
+
+	// A competing block with the transaction only goes to a side branch, so
+	// the transaction has to stay in the mempool.
+	b1 := childBlock(t, genesis, tx)
+	require.NoError(t, n.addBlock(b1))
+	assert.True(t, n.mempool.Has(tx))
+	assert.NoError(t, n.chain.ValidateTransaction(tx))
+
+	// Once the branch is the main chain the transaction is mined.
+	require.NoError(t, n.addBlock(childBlock(t, b1)))
+	assert.False(t, n.mempool.Has(tx))
+}
+
+func TestHandleTransactionConsecutiveNonces(t *testing.T) {
+	n, addr := startNode(t, ServerConfig{PrivateKey: validatorKey()}, nil)
+	c, err := makeNodeClient(addr)
+	require.NoError(t, err)
+
+	var (
+		to  = crypto.GeneratePrivateKey().Public().Address().Bytes()
+		tx0 = accountTx(validatorKey(), to, 10, 1, 0)
+		tx1 = accountTx(validatorKey(), to, 10, 1, 1)
+	)
+	_, err = c.HandleTransaction(context.Background(), tx0)
+	require.NoError(t, err)
+	_, err = c.HandleTransaction(context.Background(), tx1)
+	require.NoError(t, err)
+
+	block, err := n.createBlock(n.mempool.Pending(maxBlockTxx))
+	require.NoError(t, err)
+	require.Len(t, block.Transactions, 3)
+	assert.Equal(t, types.HashTransaction(tx0), types.HashTransaction(block.Transactions[1]))
+	assert.Equal(t, types.HashTransaction(tx1), types.HashTransaction(block.Transactions[2]))
+	require.NoError(t, n.chain.AddBlock(block))
+	assert.Equal(t, Account{Balance: 20}, n.chain.Account(to))
+}
+
+func TestCreateBlockDropsInvalidTransactions(t *testing.T) {
+	n, err := NewNode(ServerConfig{PrivateKey: validatorKey()})
+	require.NoError(t, err)
+
+	valid := spendGenesis(t, n.chain, 100)
+	fee, err := n.chain.TransactionFee(valid)
+	require.NoError(t, err)
+	require.NoError(t, n.mempool.Add(valid, fee))
+
+	// The transaction became invalid while it waited in the mempool.
+	invalid := accountTx(validatorKey(), crypto.GeneratePrivateKey().Public().Address().Bytes(), 10, 1, 5)
+	require.NoError(t, n.mempool.Add(invalid, 1))
+
+	block, err := n.createBlock(n.mempool.Pending(maxBlockTxx))
+	require.NoError(t, err)
+	require.Len(t, block.Transactions, 2)
+	assert.Equal(t, types.HashTransaction(valid), types.HashTransaction(block.Transactions[1]))
+	assert.False(t, n.mempool.Has(invalid))
+	assert.True(t, n.mempool.Has(valid))
+}
@@ -9,11 +9,85 @@ import (
 	"github.com/vlayco/blockverse/types"
 )
 
+// UTXO is an unspent transaction output.
+type UTXO struct {
+	Hash     string
+	OutIndex int
+	Amount   int64
+	Address  []byte
+	// PublicKeys and Threshold lock a multisig output, which has no Address.
+	PublicKeys [][]byte
+	Threshold  uint32
+	// LockHeight is the first height at which the output can be spent.
+	LockHeight int32
+	// LockingScript is the script spending the output has to satisfy.
+	LockingScript []byte
+}
+
+// utxoKey returns the key under which the output at index of the transaction
+// with the given (hex encoded) hash is stored.
+func utxoKey(hash string, index int) string {
+	return fmt.Sprintf("%s_%d", hash, index)
+}
+
+type UTXOStorer interface {
+	Put(*UTXO) error
+	Get(string) (*UTXO, error)
+	Delete(string) error
+}
+
+type MemoryUTXOStore struct {
+	lock  sync.RWMutex
+	utxos map[string]*UTXO
+}
+
+func NewMemoryUTXOStore() *MemoryUTXOStore {
+	return &MemoryUTXOStore{
+		utxos: make(map[string]*UTXO),
+	}
+}
+
+func (s *MemoryUTXOStore) Put(utxo *UTXO) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.utxos[utxoKey(utxo.Hash, utxo.OutIndex)] = utxo
+	return nil
+}
+
+func (s *MemoryUTXOStore) Get(key string) (*UTXO, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	utxo, ok := s.utxos[key]
+	if !ok {
+		return nil, fmt.Errorf("utxo [%s] does not exist or is already spent", key)
+	}
+
+	return utxo, nil
+}
+
+func (s *MemoryUTXOStore) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.utxos[key]; !ok {
+		return fmt.Errorf("utxo [%s] does not exist or is already spent", key)
+	}
+	delete(s.utxos, key)
+	return nil
+}
+
 type BlockStorer interface {
 	Put(*proto.Block) error
 	Get(string) (*proto.Block, error)
 }
 
+// BlockLister is implemented by block stores that persist their blocks, so
+// the chain can be rebuilt from them on start.
+type BlockLister interface {
+	BlockStorer
+	// Blocks returns all the stored blocks in the order they were put.
+	Blocks() ([]*proto.Block, error)
+}
+
 type MemoryBlockStore struct {
 	lock   sync.RWMutex
 	blocks map[string]*proto.Block
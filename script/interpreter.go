@@ -0,0 +1,301 @@
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/vlayco/blockverse/crypto"
+)
+
+// Context holds what the scripts of an input are evaluated against.
+type Context struct {
+	// SigHash is the hash signed by the signatures of the transaction.
+	SigHash []byte
+	// Height is the height of the block the transaction is included in.
+	Height int32
+}
+
+// Execute runs the unlocking script of an input followed by the locking script
+// of the output it spends. It returns nil if the output may be spent.
+func Execute(unlocking, locking []byte, ctx Context) error {
+	if !IsPushOnly(unlocking) {
+		return fmt.Errorf("%w: unlocking script is not push only", ErrInvalidScript)
+	}
+
+	vm := &vm{ctx: ctx}
+	if err := vm.run(unlocking); err != nil {
+		return err
+	}
+	if err := vm.run(locking); err != nil {
+		return err
+	}
+
+	top, err := vm.pop()
+	if err != nil {
+		return err
+	}
+	if !isTrue(top) {
+		return fmt.Errorf("%w: false result", ErrScriptFailed)
+	}
+	return nil
+}
+
+type vm struct {
+	ctx   Context
+	stack [][]byte
+}
+
+func (vm *vm) run(script []byte) error {
+	instructions, err := Parse(script)
+	if err != nil {
+		return err
+	}
+
+	// conds holds, for every enclosing OpIf, whether its current branch is
+	// executed.
+	var conds []bool
+	for _, instruction := range instructions {
+		executing := true
+		for _, cond := range conds {
+			executing = executing && cond
+		}
+
+		switch instruction.Op {
+		case OpIf:
+			cond := false
+			if executing {
+				top, err := vm.pop()
+				if err != nil {
+					return err
+				}
+				cond = isTrue(top)
+			}
+			conds = append(conds, cond)
+			continue
+		case OpElse:
+			if len(conds) == 0 {
+				return fmt.Errorf("%w: ELSE without IF", ErrInvalidScript)
+			}
+			conds[len(conds)-1] = !conds[len(conds)-1]
+			continue
+		case OpEndIf:
+			if len(conds) == 0 {
+				return fmt.Errorf("%w: ENDIF without IF", ErrInvalidScript)
+			}
+			conds = conds[:len(conds)-1]
+			continue
+		}
+
+		if !executing {
+			continue
+		}
+		if err := vm.step(instruction); err != nil {
+			return fmt.Errorf("%s: %w", instruction.Op, err)
+		}
+	}
+
+	if len(conds) != 0 {
+		return fmt.Errorf("%w: unterminated IF", ErrInvalidScript)
+	}
+	return nil
+}
+
+func (vm *vm) step(instruction Instruction) error {
+	switch instruction.Op {
+	case OpPush:
+		return vm.push(instruction.Data)
+	case OpFalse:
+		return vm.push(nil)
+	case OpTrue:
+		return vm.push(encodeInt(1))
+	case OpDup:
+		top, err := vm.peek()
+		if err != nil {
+			return err
+		}
+		return vm.push(top)
+	case OpDrop:
+		_, err := vm.pop()
+		return err
+	case OpSwap:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.stack = append(vm.stack, a, b)
+		return nil
+	case OpSHA256:
+		top, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		hash := sha256.Sum256(top)
+		return vm.push(hash[:])
+	case OpEqual, OpEqualVerify:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		return vm.result(instruction.Op == OpEqualVerify, bytes.Equal(a, b))
+	case OpVerify:
+		top, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		return vm.result(true, isTrue(top))
+	case OpCheckSig, OpCheckSigVerify:
+		pubKey, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		return vm.result(instruction.Op == OpCheckSigVerify, vm.checkSig(pubKey, sig))
+	case OpCheckMultisig:
+		ok, err := vm.checkMultisig()
+		if err != nil {
+			return err
+		}
+		return vm.result(false, ok)
+	case OpCheckLockHeight:
+		top, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		height, err := decodeInt(top)
+		if err != nil {
+			return err
+		}
+		if int64(vm.ctx.Height) < height {
+			return fmt.Errorf("%w: until height (%d)", ErrLocked, height)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: unexpected op", ErrInvalidScript)
+}
+
+// result pushes the outcome of a check, or fails if it is false and verify is
+// set.
+func (vm *vm) result(verify, ok bool) error {
+	if verify {
+		if !ok {
+			return fmt.Errorf("%w: verify failed", ErrScriptFailed)
+		}
+		return nil
+	}
+	if ok {
+		return vm.push(encodeInt(1))
+	}
+	return vm.push(nil)
+}
+
+func (vm *vm) checkSig(pubKey, sig []byte) bool {
+	key, err := crypto.ParsePublicKey(pubKey)
+	if err != nil {
+		return false
+	}
+	signature, err := crypto.ParseSignature(sig)
+	if err != nil {
+		return false
+	}
+	return signature.Verify(key, vm.ctx.SigHash)
+}
+
+func (vm *vm) checkMultisig() (bool, error) {
+	n, err := vm.popInt(0, MaxMultisigKeys)
+	if err != nil {
+		return false, err
+	}
+	pubKeys := make([][]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		if pubKeys[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	m, err := vm.popInt(0, n)
+	if err != nil {
+		return false, err
+	}
+	sigs := make([][]byte, m)
+	for i := m - 1; i >= 0; i-- {
+		if sigs[i], err = vm.pop(); err != nil {
+			return false, err
+		}
+	}
+
+	// Every signature has to match one of the remaining keys, in order.
+	k := 0
+	for _, sig := range sigs {
+		for k < len(pubKeys) && !vm.checkSig(pubKeys[k], sig) {
+			k++
+		}
+		if k == len(pubKeys) {
+			return false, nil
+		}
+		k++
+	}
+	return true, nil
+}
+
+// popInt pops a number in the range [min, max].
+func (vm *vm) popInt(min, max int) (int, error) {
+	top, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+	n, err := decodeInt(top)
+	if err != nil {
+		return 0, err
+	}
+	if n < int64(min) || n > int64(max) {
+		return 0, fmt.Errorf("%w: number (%d) out of range", ErrScriptFailed, n)
+	}
+	return int(n), nil
+}
+
+func (vm *vm) push(item []byte) error {
+	if len(vm.stack) >= MaxStackSize {
+		return fmt.Errorf("%w: stack overflow", ErrScriptFailed)
+	}
+	vm.stack = append(vm.stack, item)
+	return nil
+}
+
+func (vm *vm) pop() ([]byte, error) {
+	top, err := vm.peek()
+	if err != nil {
+		return nil, err
+	}
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return top, nil
+}
+
+func (vm *vm) peek() ([]byte, error) {
+	if len(vm.stack) == 0 {
+		return nil, fmt.Errorf("%w: stack is empty", ErrScriptFailed)
+	}
+	return vm.stack[len(vm.stack)-1], nil
+}
+
+// isTrue reports whether the item is true, which is the case if any of its
+// bytes is not zero.
+func isTrue(item []byte) bool {
+	for _, b := range item {
+		if b != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+// Package script implements the small stack based language that describes the
+// conditions for spending an output.
+//
+// An output carries a locking script and the input spending it an unlocking
+// script. The unlocking script may only push data, which the locking script
+// then consumes. The output can be spent if the locking script leaves a true
+// value on top of the stack.
+package script
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Op is a single instruction of a script.
+type Op byte
+
+const (
+	// OpPush pushes the data following it, prefixed by its length as a
+	// 2 byte big endian integer.
+	OpPush Op = iota + 1
+	// OpFalse pushes an empty item, which is false.
+	OpFalse
+	// OpTrue pushes the number 1.
+	OpTrue
+	// OpDup duplicates the top item.
+	OpDup
+	// OpDrop removes the top item.
+	OpDrop
+	// OpSwap swaps the two top items.
+	OpSwap
+	// OpSHA256 replaces the top item by its sha256 hash.
+	OpSHA256
+	// OpEqual replaces the two top items by true if they are equal.
+	OpEqual
+	// OpEqualVerify is OpEqual followed by OpVerify.
+	OpEqualVerify
+	// OpVerify removes the top item and fails unless it's true.
+	OpVerify
+	// OpCheckSig pops a public key and a signature and pushes true if the
+	// signature of the transaction is valid for the key.
+	OpCheckSig
+	// OpCheckSigVerify is OpCheckSig followed by OpVerify.
+	OpCheckSigVerify
+	// OpCheckMultisig pops the number of keys n, n public keys, the
+	// threshold m and m signatures, and pushes true if every signature is
+	// valid for one of the keys. The signatures have to be in the same order
+	// as their keys.
+	OpCheckMultisig
+	// OpCheckLockHeight pops a height and fails if the transaction is
+	// included in a block below it.
+	OpCheckLockHeight
+	// OpIf removes the top item and executes the following ops only if it's
+	// true, up to the matching OpElse or OpEndIf.
+	OpIf
+	// OpElse executes the following ops only if the ones after the matching
+	// OpIf were not.
+	OpElse
+	// OpEndIf ends an OpIf block.
+	OpEndIf
+)
+
+var opNames = map[Op]string{
+	OpPush:            "PUSH",
+	OpFalse:           "FALSE",
+	OpTrue:            "TRUE",
+	OpDup:             "DUP",
+	OpDrop:            "DROP",
+	OpSwap:            "SWAP",
+	OpSHA256:          "SHA256",
+	OpEqual:           "EQUAL",
+	OpEqualVerify:     "EQUALVERIFY",
+	OpVerify:          "VERIFY",
+	OpCheckSig:        "CHECKSIG",
+	OpCheckSigVerify:  "CHECKSIGVERIFY",
+	OpCheckMultisig:   "CHECKMULTISIG",
+	OpCheckLockHeight: "CHECKLOCKHEIGHT",
+	OpIf:              "IF",
+	OpElse:            "ELSE",
+	OpEndIf:           "ENDIF",
+}
+
+func (op Op) String() string {
+	if name, ok := opNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", byte(op))
+}
+
+const (
+	// MaxScriptSize is the maximum size of a script in bytes.
+	MaxScriptSize = 10_000
+	// MaxDataSize is the maximum size of a single pushed item.
+	MaxDataSize = 520
+	// MaxStackSize is the maximum number of items on the stack.
+	MaxStackSize = 1000
+	// MaxMultisigKeys is the maximum number of keys of OpCheckMultisig.
+	MaxMultisigKeys = 16
+)
+
+var (
+	// ErrInvalidScript is returned for scripts that can't be parsed.
+	ErrInvalidScript = errors.New("invalid script")
+	// ErrScriptFailed is returned when executing the scripts doesn't end with
+	// a true value on top of the stack.
+	ErrScriptFailed = errors.New("script failed")
+	// ErrLocked is returned when OpCheckLockHeight fails, so the scripts may
+	// succeed in a later block.
+	ErrLocked = errors.New("script is timelocked")
+)
+
+// Instruction is a parsed op together with the data it pushes.
+type Instruction struct {
+	Op   Op
+	Data []byte
+}
+
+// Parse splits the script into its instructions.
+func Parse(script []byte) ([]Instruction, error) {
+	if len(script) > MaxScriptSize {
+		return nil, fmt.Errorf("%w: size (%d) exceeds (%d)", ErrInvalidScript, len(script), MaxScriptSize)
+	}
+
+	var instructions []Instruction
+	for i := 0; i < len(script); {
+		op := Op(script[i])
+		i++
+		if _, ok := opNames[op]; !ok {
+			return nil, fmt.Errorf("%w: unknown op (%d) at (%d)", ErrInvalidScript, byte(op), i-1)
+		}
+
+		instruction := Instruction{Op: op}
+		if op == OpPush {
+			if len(script)-i < 2 {
+				return nil, fmt.Errorf("%w: truncated push at (%d)", ErrInvalidScript, i-1)
+			}
+			size := int(binary.BigEndian.Uint16(script[i:]))
+			i += 2
+			if size > MaxDataSize {
+				return nil, fmt.Errorf("%w: push size (%d) exceeds (%d)", ErrInvalidScript, size, MaxDataSize)
+			}
+			if len(script)-i < size {
+				return nil, fmt.Errorf("%w: truncated push at (%d)", ErrInvalidScript, i-3)
+			}
+			instruction.Data = script[i : i+size]
+			i += size
+		}
+		instructions = append(instructions, instruction)
+	}
+	return instructions, nil
+}
+
+// IsPushOnly reports whether the script is valid and only pushes data.
+func IsPushOnly(script []byte) bool {
+	instructions, err := Parse(script)
+	if err != nil {
+		return false
+	}
+	for _, instruction := range instructions {
+		switch instruction.Op {
+		case OpPush, OpFalse, OpTrue:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Builder assembles a script.
+type Builder struct {
+	script []byte
+}
+
+// NewBuilder returns an empty script builder.
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// AddOp appends the ops to the script.
+func (b *Builder) AddOp(ops ...Op) *Builder {
+	for _, op := range ops {
+		b.script = append(b.script, byte(op))
+	}
+	return b
+}
+
+// AddData appends an instruction pushing the data.
+func (b *Builder) AddData(data []byte) *Builder {
+	b.script = append(b.script, byte(OpPush))
+	b.script = binary.BigEndian.AppendUint16(b.script, uint16(len(data)))
+	b.script = append(b.script, data...)
+	return b
+}
+
+// AddInt appends an instruction pushing the number.
+func (b *Builder) AddInt(n int64) *Builder {
+	return b.AddData(encodeInt(n))
+}
+
+// Script returns the assembled script.
+func (b *Builder) Script() []byte {
+	return b.script
+}
+
+// PayToPubKey returns the locking script requiring a signature of the key.
+func PayToPubKey(pubKey []byte) []byte {
+	return NewBuilder().AddData(pubKey).AddOp(OpCheckSig).Script()
+}
+
+// Multisig returns the locking script requiring signatures of threshold of the
+// keys.
+func Multisig(threshold int, pubKeys [][]byte) []byte {
+	b := NewBuilder().AddInt(int64(threshold))
+	for _, pubKey := range pubKeys {
+		b.AddData(pubKey)
+	}
+	return b.AddInt(int64(len(pubKeys))).AddOp(OpCheckMultisig).Script()
+}
+
+// HashLock returns the locking script requiring the preimage of the sha256
+// hash and a signature of the key.
+func HashLock(hash, pubKey []byte) []byte {
+	return NewBuilder().
+		AddOp(OpSHA256).AddData(hash).AddOp(OpEqualVerify).
+		AddData(pubKey).AddOp(OpCheckSig).
+		Script()
+}
+
+// encodeInt encodes numbers as 8 byte big endian integers.
+func encodeInt(n int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(n))
+}
+
+func decodeInt(b []byte) (int64, error) {
+	if len(b) != 8 {
+		return 0, fmt.Errorf("%w: invalid number length (%d)", ErrScriptFailed, len(b))
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
@@ -0,0 +1,139 @@
+package script
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/util"
+)
+
+func TestParse(t *testing.T) {
+	script := NewBuilder().AddData([]byte("data")).AddOp(OpDup, OpEqual).Script()
+	instructions, err := Parse(script)
+	require.NoError(t, err)
+	assert.Equal(t, []Instruction{
+		{Op: OpPush, Data: []byte("data")},
+		{Op: OpDup},
+		{Op: OpEqual},
+	}, instructions)
+
+	// Truncated pushes and unknown ops.
+	_, err = Parse(script[:5])
+	assert.ErrorIs(t, err, ErrInvalidScript)
+	_, err = Parse(script[:2])
+	assert.ErrorIs(t, err, ErrInvalidScript)
+	_, err = Parse([]byte{0xff})
+	assert.ErrorIs(t, err, ErrInvalidScript)
+
+	assert.True(t, IsPushOnly(NewBuilder().AddData([]byte("data")).AddOp(OpTrue).Script()))
+	assert.False(t, IsPushOnly(script))
+}
+
+func TestPayToPubKey(t *testing.T) {
+	var (
+		privKey = crypto.GeneratePrivateKey()
+		hash    = util.RandomHash()
+		locking = PayToPubKey(privKey.Public().Bytes())
+	)
+
+	unlocking := NewBuilder().AddData(privKey.Sign(hash).Bytes()).Script()
+	assert.NoError(t, Execute(unlocking, locking, Context{SigHash: hash}))
+	assert.ErrorIs(t, Execute(unlocking, locking, Context{SigHash: util.RandomHash()}), ErrScriptFailed)
+
+	// The unlocking script may only push data.
+	unlocking = NewBuilder().AddOp(OpTrue, OpVerify).Script()
+	assert.ErrorIs(t, Execute(unlocking, locking, Context{SigHash: hash}), ErrInvalidScript)
+
+	// An empty stack.
+	assert.ErrorIs(t, Execute(nil, locking, Context{SigHash: hash}), ErrScriptFailed)
+}
+
+func TestMultisig(t *testing.T) {
+	var (
+		hash = util.RandomHash()
+		keys = []*crypto.PrivateKey{
+			crypto.GeneratePrivateKey(),
+			crypto.GeneratePrivateKey(),
+			crypto.GeneratePrivateKey(),
+		}
+		pubKeys [][]byte
+	)
+	for _, key := range keys {
+		pubKeys = append(pubKeys, key.Public().Bytes())
+	}
+	locking := Multisig(2, pubKeys)
+
+	sign := func(signers ...*crypto.PrivateKey) []byte {
+		b := NewBuilder()
+		for _, signer := range signers {
+			b.AddData(signer.Sign(hash).Bytes())
+		}
+		return b.Script()
+	}
+
+	ctx := Context{SigHash: hash}
+	assert.NoError(t, Execute(sign(keys[0], keys[1]), locking, ctx))
+	assert.NoError(t, Execute(sign(keys[0], keys[2]), locking, ctx))
+	// The signatures have to be in the order of the keys.
+	assert.Error(t, Execute(sign(keys[2], keys[0]), locking, ctx))
+	// The same key can't sign twice.
+	assert.Error(t, Execute(sign(keys[1], keys[1]), locking, ctx))
+	assert.Error(t, Execute(sign(keys[0]), locking, ctx))
+}
+
+func TestHashTimeLock(t *testing.T) {
+	var (
+		sender    = crypto.GeneratePrivateKey()
+		recipient = crypto.GeneratePrivateKey()
+		preimage  = []byte("secret")
+		hash      = sha256.Sum256(preimage)
+		sigHash   = util.RandomHash()
+	)
+
+	// The recipient can claim the output with the preimage, the sender gets
+	// it back from height 100 on.
+	locking := NewBuilder().
+		AddOp(OpIf).
+		AddOp(OpSHA256).AddData(hash[:]).AddOp(OpEqualVerify).
+		AddData(recipient.Public().Bytes()).
+		AddOp(OpElse).
+		AddInt(100).AddOp(OpCheckLockHeight).
+		AddData(sender.Public().Bytes()).
+		AddOp(OpEndIf).
+		AddOp(OpCheckSig).
+		Script()
+
+	claim := NewBuilder().
+		AddData(recipient.Sign(sigHash).Bytes()).
+		AddData(preimage).
+		AddOp(OpTrue).
+		Script()
+	assert.NoError(t, Execute(claim, locking, Context{SigHash: sigHash, Height: 1}))
+
+	wrongPreimage := NewBuilder().
+		AddData(recipient.Sign(sigHash).Bytes()).
+		AddData([]byte("guess")).
+		AddOp(OpTrue).
+		Script()
+	assert.ErrorIs(t, Execute(wrongPreimage, locking, Context{SigHash: sigHash, Height: 1}), ErrScriptFailed)
+
+	refund := NewBuilder().
+		AddData(sender.Sign(sigHash).Bytes()).
+		AddOp(OpFalse).
+		Script()
+	assert.ErrorIs(t, Execute(refund, locking, Context{SigHash: sigHash, Height: 99}), ErrLocked)
+	assert.NoError(t, Execute(refund, locking, Context{SigHash: sigHash, Height: 100}))
+}
+
+func TestUnbalancedIf(t *testing.T) {
+	ctx := Context{SigHash: util.RandomHash()}
+	unlocking := NewBuilder().AddOp(OpTrue).Script()
+
+	assert.ErrorIs(t, Execute(unlocking, NewBuilder().AddOp(OpIf, OpTrue).Script(), ctx), ErrInvalidScript)
+	assert.ErrorIs(t, Execute(unlocking, NewBuilder().AddOp(OpEndIf).Script(), ctx), ErrInvalidScript)
+	assert.ErrorIs(t, Execute(unlocking, NewBuilder().AddOp(OpElse).Script(), ctx), ErrInvalidScript)
+	assert.NoError(t, Execute(unlocking, NewBuilder().AddOp(OpIf, OpTrue, OpElse, OpFalse, OpEndIf).Script(), ctx))
+}
@@ -0,0 +1,28 @@
+package types
+
+import (
+	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/proto"
+)
+
+// NewAccountTransaction creates an unsigned transaction moving the amount from
+// the account of from to the account with the address to. The nonce has to be
+// the number of transactions sent from the account before.
+func NewAccountTransaction(from *crypto.PublicKey, to []byte, amount, fee int64, nonce uint64) *proto.Transaction {
+	return &proto.Transaction{
+		Version: 1,
+		Account: &proto.AccountTx{
+			From:   from.Bytes(),
+			To:     to,
+			Amount: amount,
+			Fee:    fee,
+			Nonce:  nonce,
+		},
+	}
+}
+
+// IsAccountTransaction reports whether the transaction moves coins between
+// account balances instead of spending outputs.
+func IsAccountTransaction(tx *proto.Transaction) bool {
+	return tx.Account != nil
+}
@@ -0,0 +1,26 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vlayco/blockverse/crypto"
+)
+
+func TestSignAccountTransaction(t *testing.T) {
+	var (
+		from = crypto.GeneratePrivateKey()
+		to   = crypto.GeneratePrivateKey().Public().Address().Bytes()
+	)
+	tx := NewAccountTransaction(from.Public(), to, 10, 1, 0)
+	assert.True(t, IsAccountTransaction(tx))
+	assert.False(t, VerifyTransaction(tx))
+
+	assert.Error(t, SignTransactionInputs(tx, crypto.GeneratePrivateKey()))
+	assert.NoError(t, SignTransactionInputs(tx, from))
+	assert.True(t, VerifyTransaction(tx))
+
+	// The nonce is covered by the signature.
+	tx.Account.Nonce = 1
+	assert.False(t, VerifyTransaction(tx))
+}
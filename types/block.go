@@ -4,21 +4,22 @@ import (
 	"crypto/sha256"
 
 	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/merkle"
 	"github.com/vlayco/blockverse/proto"
 	pb "google.golang.org/protobuf/proto"
 )
 
 func VerifyBlock(b *proto.Block) bool {
-	if len(b.PublicKey) != crypto.PubKeyLen {
+	pubKey, err := crypto.ParsePublicKey(b.PublicKey)
+	if err != nil {
 		return false
 	}
 
-	if len(b.Signature) != crypto.SignatureLen {
+	sig, err := crypto.ParseSignature(b.Signature)
+	if err != nil {
 		return false
 	}
 
-	sig := crypto.SignatureFromBytes(b.Signature)
-	pubKey := crypto.PublicKeyFromBytes(b.PublicKey)
 	hash := HashBlock(b)
 	return sig.Verify(pubKey, hash)
 }
@@ -45,3 +46,29 @@ func HashHeader(header *proto.Header) []byte {
 	hash := sha256.Sum256(bytes)
 	return hash[:]
 }
+
+// CalculateRootHash returns the Merkle root of the given transactions in the
+// order they appear in the block.
+func CalculateRootHash(txx []*proto.Transaction) []byte {
+	return transactionTree(txx).Root()
+}
+
+// TransactionProof returns the proof that the transaction at the given index
+// is part of the block.
+func TransactionProof(b *proto.Block, index int) (*merkle.Proof, error) {
+	return transactionTree(b.Transactions).Proof(index)
+}
+
+// VerifyTransactionProof reports whether the proof shows that the transaction
+// is committed to by the root hash of the header.
+func VerifyTransactionProof(header *proto.Header, tx *proto.Transaction, proof *merkle.Proof) bool {
+	return merkle.VerifyProof(header.RootHash, HashTransaction(tx), proof)
+}
+
+func transactionTree(txx []*proto.Transaction) *merkle.Tree {
+	leaves := make([][]byte, len(txx))
+	for i, tx := range txx {
+		leaves[i] = HashTransaction(tx)
+	}
+	return merkle.NewTree(leaves)
+}
@@ -4,7 +4,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/proto"
 	"github.com/vlayco/blockverse/util"
 )
 
@@ -35,3 +37,38 @@ func TestSignVerifyBlock(t *testing.T) {
 	block.PublicKey = invalidPrivKey.Public().Bytes()
 	assert.False(t, VerifyBlock(block))
 }
+
+func TestCalculateRootHash(t *testing.T) {
+	txx := []*proto.Transaction{
+		{Version: 1},
+		{Version: 2},
+	}
+
+	root := CalculateRootHash(txx)
+	assert.Equal(t, 32, len(root))
+	assert.Equal(t, root, CalculateRootHash(txx))
+
+	// Changing the order of the transactions changes the root.
+	assert.NotEqual(t, root, CalculateRootHash([]*proto.Transaction{txx[1], txx[0]}))
+}
+
+func TestTransactionProof(t *testing.T) {
+	block := util.RandomBlock()
+	for i := 0; i < 5; i++ {
+		block.Transactions = append(block.Transactions, &proto.Transaction{Version: int32(i)})
+	}
+	block.Header.RootHash = CalculateRootHash(block.Transactions)
+
+	for i, tx := range block.Transactions {
+		proof, err := TransactionProof(block, i)
+		require.NoError(t, err)
+		assert.True(t, VerifyTransactionProof(block.Header, tx, proof))
+	}
+
+	proof, err := TransactionProof(block, 0)
+	require.NoError(t, err)
+	assert.False(t, VerifyTransactionProof(block.Header, &proto.Transaction{Version: 10}, proof))
+
+	_, err = TransactionProof(block, 5)
+	assert.Error(t, err)
+}
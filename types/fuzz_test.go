@@ -0,0 +1,89 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/util"
+	pb "google.golang.org/protobuf/proto"
+)
+
+// FuzzVerifyTransaction feeds transactions decoded from random bytes to
+// VerifyTransaction, which must never panic on them.
+func FuzzVerifyTransaction(f *testing.F) {
+	var (
+		privKey = crypto.GeneratePrivateKey()
+		keys    = []*crypto.PrivateKey{crypto.GeneratePrivateKey(), crypto.GeneratePrivateKey()}
+	)
+
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash: util.RandomHash(),
+			PublicKey:  privKey.Public().Bytes(),
+		}},
+		Outputs: []*proto.TxOutput{{Amount: 10, Address: privKey.Public().Address().Bytes()}},
+	}
+	mustSign(f, tx, privKey)
+
+	multisig := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash: util.RandomHash(),
+			PublicKeys: [][]byte{keys[0].Public().Bytes(), keys[1].Public().Bytes()},
+		}},
+	}
+	mustSign(f, multisig, keys...)
+
+	account := NewAccountTransaction(privKey.Public(), privKey.Public().Address().Bytes(), 10, 1, 0)
+	mustSign(f, account, privKey)
+
+	for _, tx := range []*proto.Transaction{tx, multisig, account, NewCoinbaseTransaction(1, privKey.Public().Address().Bytes(), 50)} {
+		b, err := pb.Marshal(tx)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		tx := &proto.Transaction{}
+		if err := pb.Unmarshal(b, tx); err != nil {
+			return
+		}
+		VerifyTransaction(tx)
+		for i := range tx.Inputs {
+			VerifyInputScript(tx, i, tx.Inputs[i].UnlockingScript, 0)
+		}
+	})
+}
+
+// FuzzVerifyBlock feeds blocks decoded from random bytes to VerifyBlock, which
+// must never panic on them.
+func FuzzVerifyBlock(f *testing.F) {
+	block := util.RandomBlock()
+	SignBlock(crypto.GeneratePrivateKey(), block)
+	b, err := pb.Marshal(block)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b)
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		block := &proto.Block{}
+		if err := pb.Unmarshal(b, block); err != nil {
+			return
+		}
+		VerifyBlock(block)
+		CalculateRootHash(block.Transactions)
+	})
+}
+
+func mustSign(f *testing.F, tx *proto.Transaction, keys ...*crypto.PrivateKey) {
+	if err := SignTransactionInputs(tx, keys...); err != nil {
+		f.Fatal(err)
+	}
+}
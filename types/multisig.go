@@ -0,0 +1,114 @@
+package types
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/script"
+)
+
+// MaxMultisigKeys is the maximum number of public keys of a multisig output.
+const MaxMultisigKeys = script.MaxMultisigKeys
+
+// NewMultisigOutput creates an output locking the amount to the given public
+// keys, spendable with the signatures of any threshold of them.
+func NewMultisigOutput(amount int64, threshold uint32, keys ...*crypto.PublicKey) *proto.TxOutput {
+	output := &proto.TxOutput{
+		Amount:    amount,
+		Threshold: threshold,
+	}
+	for _, key := range keys {
+		output.PublicKeys = append(output.PublicKeys, key.Bytes())
+	}
+	return output
+}
+
+// IsMultisigOutput reports whether the output is locked to a set of public
+// keys instead of an address.
+func IsMultisigOutput(output *proto.TxOutput) bool {
+	return len(output.PublicKeys) > 0
+}
+
+// IsMultisigInput reports whether the input carries the signatures for
+// spending a multisig output.
+func IsMultisigInput(input *proto.TxInput) bool {
+	return len(input.PublicKeys) > 0
+}
+
+// ValidateOutput checks that the output is either locked to an address, is a
+// well formed M-of-N multisig output or carries a valid locking script.
+func ValidateOutput(output *proto.TxOutput) error {
+	if len(output.LockingScript) > 0 {
+		if len(output.Address) != 0 || len(output.PublicKeys) != 0 || output.Threshold != 0 {
+			return errors.New("script output with an address or public keys")
+		}
+		if _, err := script.Parse(output.LockingScript); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	if !IsMultisigOutput(output) {
+		if err := crypto.ValidateAddress(output.Address); err != nil {
+			return fmt.Errorf("invalid output address: %w", err)
+		}
+		if output.Threshold != 0 {
+			return errors.New("threshold on an address output")
+		}
+		return nil
+	}
+
+	if len(output.Address) != 0 {
+		return errors.New("multisig output with an address")
+	}
+	if len(output.PublicKeys) > MaxMultisigKeys {
+		return fmt.Errorf("too many multisig keys (%d)", len(output.PublicKeys))
+	}
+	if output.Threshold == 0 || int(output.Threshold) > len(output.PublicKeys) {
+		return fmt.Errorf("invalid multisig threshold (%d) of (%d) keys", output.Threshold, len(output.PublicKeys))
+	}
+	if err := validateKeys(output.PublicKeys); err != nil {
+		return fmt.Errorf("invalid multisig keys: %w", err)
+	}
+	return nil
+}
+
+// SatisfiesMultisig reports whether the signing keys of the input are at least
+// threshold distinct keys out of keys. The signatures themselves are checked
+// by VerifyTransaction.
+func SatisfiesMultisig(input *proto.TxInput, keys [][]byte, threshold uint32) bool {
+	if !IsMultisigInput(input) || validateKeys(input.PublicKeys) != nil {
+		return false
+	}
+	for _, signer := range input.PublicKeys {
+		if !containsKey(keys, signer) {
+			return false
+		}
+	}
+	return len(input.PublicKeys) >= int(threshold)
+}
+
+// validateKeys checks that the keys are valid and distinct public keys.
+func validateKeys(keys [][]byte) error {
+	for i, key := range keys {
+		if len(key) != crypto.PubKeyLen {
+			return fmt.Errorf("invalid public key length (%d)", len(key))
+		}
+		if containsKey(keys[:i], key) {
+			return errors.New("duplicate public key")
+		}
+	}
+	return nil
+}
+
+func containsKey(keys [][]byte, key []byte) bool {
+	for _, k := range keys {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+	return false
+}
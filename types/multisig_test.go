@@ -0,0 +1,61 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/util"
+)
+
+func TestValidateOutput(t *testing.T) {
+	var (
+		key1 = crypto.GeneratePrivateKey().Public()
+		key2 = crypto.GeneratePrivateKey().Public()
+	)
+
+	assert.NoError(t, ValidateOutput(&proto.TxOutput{Amount: 1, Address: key1.Address().Bytes()}))
+	assert.NoError(t, ValidateOutput(NewMultisigOutput(1, 1, key1, key2)))
+	assert.NoError(t, ValidateOutput(NewMultisigOutput(1, 2, key1, key2)))
+
+	assert.Error(t, ValidateOutput(&proto.TxOutput{Amount: 1}))
+	assert.Error(t, ValidateOutput(&proto.TxOutput{Amount: 1, Address: key1.LegacyAddress().Bytes()}))
+	assert.Error(t, ValidateOutput(NewMultisigOutput(1, 0, key1, key2)))
+	assert.Error(t, ValidateOutput(NewMultisigOutput(1, 3, key1, key2)))
+	assert.Error(t, ValidateOutput(NewMultisigOutput(1, 2, key1, key1)))
+
+	output := NewMultisigOutput(1, 1, key1)
+	output.Address = key1.Address().Bytes()
+	assert.Error(t, ValidateOutput(output))
+}
+
+func TestVerifyMultisigTransaction(t *testing.T) {
+	var (
+		key1 = crypto.GeneratePrivateKey()
+		key2 = crypto.GeneratePrivateKey()
+		keys = [][]byte{key1.Public().Bytes(), key2.Public().Bytes()}
+	)
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash: util.RandomHash(),
+			PublicKeys: keys,
+		}},
+		Outputs: []*proto.TxOutput{{Amount: 10, Address: key1.Public().Address().Bytes()}},
+	}
+	assert.Error(t, SignTransactionInputs(tx, key1))
+	assert.NoError(t, SignTransactionInputs(tx, key1, key2))
+	assert.True(t, VerifyTransaction(tx))
+	assert.True(t, SatisfiesMultisig(tx.Inputs[0], keys, 2))
+	assert.False(t, SatisfiesMultisig(tx.Inputs[0], keys[:1], 1))
+
+	// Swapped signatures don't verify.
+	input := tx.Inputs[0]
+	input.Signatures[0], input.Signatures[1] = input.Signatures[1], input.Signatures[0]
+	assert.False(t, VerifyTransaction(tx))
+
+	// Missing signatures don't verify.
+	input.Signatures = input.Signatures[:1]
+	assert.False(t, VerifyTransaction(tx))
+}
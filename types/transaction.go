@@ -1,15 +1,113 @@
 package types
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"fmt"
 
 	"github.com/vlayco/blockverse/crypto"
 	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/script"
 	pb "google.golang.org/protobuf/proto"
 )
 
+// NewCoinbaseTransaction creates the transaction paying the given amount of
+// new coins to the producer of the block at the given height. Its single
+// input does not spend any output; it carries the height of the block in
+// PrevOutIndex instead, so every coinbase transaction has a unique hash.
+func NewCoinbaseTransaction(height int32, address []byte, amount int64) *proto.Transaction {
+	return &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{
+			{
+				PrevOutIndex: uint32(height),
+			},
+		},
+		Outputs: []*proto.TxOutput{
+			{
+				Amount:  amount,
+				Address: address,
+			},
+		},
+	}
+}
+
+// IsCoinbase reports whether the transaction is a coinbase transaction, which
+// has a single input without a previous transaction.
+func IsCoinbase(tx *proto.Transaction) bool {
+	return len(tx.Inputs) == 1 && len(tx.Inputs[0].PrevTxHash) == 0
+}
+
+// IsFinal reports whether the timelock of the transaction allows including it
+// in a block at the given height and timestamp.
+func IsFinal(tx *proto.Transaction, height int32, timestamp int64) bool {
+	return tx.LockHeight <= height && tx.LockTime <= timestamp
+}
+
+// SigHash returns the hash signed by the inputs of the transaction, which is
+// the hash of a copy of the transaction with the signatures of all the inputs
+// cleared. The transaction itself is left untouched.
+func SigHash(tx *proto.Transaction) []byte {
+	clone := pb.Clone(tx).(*proto.Transaction)
+	for _, input := range clone.Inputs {
+		input.Signature = nil
+		input.Signatures = nil
+		input.UnlockingScript = nil
+	}
+	if clone.Account != nil {
+		clone.Account.Signature = nil
+	}
+	return HashTransaction(clone)
+}
+
+// SignTransaction signs the SigHash of the transaction. The signature belongs
+// into the inputs spending outputs owned by pk.
 func SignTransaction(pk *crypto.PrivateKey, tx *proto.Transaction) *crypto.Signature {
-	return pk.Sign(HashTransaction(tx))
+	return pk.Sign(SigHash(tx))
+}
+
+// SignTransactionInputs signs every input of the transaction with the keys
+// matching the public key of the input, or all the signing keys of a multisig
+// input. Account transactions are signed by the key of the sender.
+func SignTransactionInputs(tx *proto.Transaction, keys ...*crypto.PrivateKey) error {
+	hash := SigHash(tx)
+	if IsAccountTransaction(tx) {
+		key := findKey(keys, tx.Account.From)
+		if key == nil {
+			return fmt.Errorf("no private key for account transaction")
+		}
+		tx.Account.Signature = key.Sign(hash).Bytes()
+	}
+	for i, input := range tx.Inputs {
+		if !IsMultisigInput(input) {
+			key := findKey(keys, input.PublicKey)
+			if key == nil {
+				return fmt.Errorf("no private key for input (%d)", i)
+			}
+			input.Signature = key.Sign(hash).Bytes()
+			continue
+		}
+
+		signatures := make([][]byte, len(input.PublicKeys))
+		for j, pubKey := range input.PublicKeys {
+			key := findKey(keys, pubKey)
+			if key == nil {
+				return fmt.Errorf("no private key for signer (%d) of input (%d)", j, i)
+			}
+			signatures[j] = key.Sign(hash).Bytes()
+		}
+		input.Signatures = signatures
+	}
+	return nil
+}
+
+func findKey(keys []*crypto.PrivateKey, pubKey []byte) *crypto.PrivateKey {
+	for _, key := range keys {
+		if bytes.Equal(key.Public().Bytes(), pubKey) {
+			return key
+		}
+	}
+	return nil
 }
 
 func HashTransaction(tx *proto.Transaction) []byte {
@@ -22,19 +120,105 @@ func HashTransaction(tx *proto.Transaction) []byte {
 	return hash[:]
 }
 
+// VerifyTransaction verifies the signatures of all the inputs against the
+// SigHash of the transaction: a key input has to be signed by its key and a
+// multisig input has to satisfy the script.Multisig script of all its signing
+// keys. Inputs with an unlocking script can only be verified against the
+// output they spend with VerifyInputScript. Account transactions have to be
+// signed by the sender.
 func VerifyTransaction(tx *proto.Transaction) bool {
-	for _, input := range tx.Inputs {
-		var (
-			sig    = crypto.SignatureFromBytes(input.Signature)
-			pubKey = crypto.PublicKeyFromBytes(input.PublicKey)
-		)
-		// This is because before signing transaction we don't have the signature!
-		// TODO: make sure we don't run into problems after verification because
-		// we've set the signature to nil!
-		input.Signature = nil
-		if !sig.Verify(pubKey, HashTransaction(tx)) {
+	v := crypto.NewBatchVerifier(1)
+	return AddTransactionSignatures(v, tx) && v.Verify()
+}
+
+// AddTransactionSignatures checks the transaction like VerifyTransaction, but
+// adds the signatures of its key inputs and of the account transaction to the
+// verifier instead of verifying them. Multisig inputs are verified right away.
+// The transaction is valid if it returns true and the verifier verifies.
+func AddTransactionSignatures(v *crypto.BatchVerifier, tx *proto.Transaction) bool {
+	sigHash := SigHash(tx)
+	if IsAccountTransaction(tx) {
+		if !addSignature(v, tx.Account.From, sigHash, tx.Account.Signature) {
 			return false
 		}
 	}
+
+	for _, input := range tx.Inputs {
+		switch {
+		case IsScriptInput(input):
+			if len(input.PublicKey) != 0 || len(input.Signature) != 0 || len(input.PublicKeys) != 0 || len(input.Signatures) != 0 {
+				return false
+			}
+			if !script.IsPushOnly(input.UnlockingScript) {
+				return false
+			}
+		case IsMultisigInput(input):
+			unlocking, locking, ok := multisigScripts(input)
+			if !ok {
+				return false
+			}
+			if err := script.Execute(unlocking, locking, script.Context{SigHash: sigHash}); err != nil {
+				return false
+			}
+		default:
+			if len(input.Signatures) != 0 {
+				return false
+			}
+			if !addSignature(v, input.PublicKey, sigHash, input.Signature) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// addSignature adds the signature to the verifier, which is equivalent
+// to running it against the script.PayToPubKey script of the key.
+func addSignature(v *crypto.BatchVerifier, pubKey, msg, sig []byte) bool {
+	key, err := crypto.ParsePublicKey(pubKey)
+	if err != nil {
+		return false
+	}
+	signature, err := crypto.ParseSignature(sig)
+	if err != nil {
+		return false
+	}
+	v.Add(key, msg, signature)
 	return true
 }
+
+// VerifyInputScript runs the unlocking script of the input at index against
+// the locking script of the output it spends, for including the transaction in
+// a block at the given height.
+func VerifyInputScript(tx *proto.Transaction, index int, locking []byte, height int32) error {
+	input := tx.Inputs[index]
+	if !IsScriptInput(input) {
+		return fmt.Errorf("input (%d) has no unlocking script", index)
+	}
+	return script.Execute(input.UnlockingScript, locking, script.Context{
+		SigHash: SigHash(tx),
+		Height:  height,
+	})
+}
+
+// IsScriptInput reports whether the input unlocks an output with a locking
+// script.
+func IsScriptInput(input *proto.TxInput) bool {
+	return len(input.UnlockingScript) > 0
+}
+
+// multisigScripts returns the scripts equivalent to the signatures of a
+// multisig input, or false if the input is malformed.
+func multisigScripts(input *proto.TxInput) (unlocking, locking []byte, ok bool) {
+	if len(input.PublicKey) != 0 || len(input.Signature) != 0 {
+		return nil, nil, false
+	}
+	if len(input.PublicKeys) != len(input.Signatures) {
+		return nil, nil, false
+	}
+	b := script.NewBuilder()
+	for _, sig := range input.Signatures {
+		b.AddData(sig)
+	}
+	return b.Script(), script.Multisig(len(input.PublicKeys), input.PublicKeys), true
+}
@@ -63,3 +63,112 @@ func TestNewTransaction(t *testing.T) {
 
 	fmt.Printf("%+v\n", tx)
 }
+
+func TestVerifyTransactionMissingSignature(t *testing.T) {
+	privKey := crypto.GeneratePrivateKey()
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{{
+			PrevTxHash: util.RandomHash(),
+			PublicKey:  privKey.Public().Bytes(),
+		}},
+	}
+
+	assert.False(t, VerifyTransaction(tx))
+}
+
+func TestCoinbaseTransaction(t *testing.T) {
+	address := crypto.GeneratePrivateKey().Public().Address().Bytes()
+	tx := NewCoinbaseTransaction(10, address, 50)
+	assert.True(t, IsCoinbase(tx))
+
+	// Coinbases for different heights have different hashes.
+	assert.NotEqual(t, HashTransaction(tx), HashTransaction(NewCoinbaseTransaction(11, address, 50)))
+
+	tx.Inputs[0].PrevTxHash = util.RandomHash()
+	assert.False(t, IsCoinbase(tx))
+}
+
+func TestSignTransactionInputs(t *testing.T) {
+	var (
+		key1 = crypto.GeneratePrivateKey()
+		key2 = crypto.GeneratePrivateKey()
+	)
+	tx := &proto.Transaction{
+		Version: 1,
+		Inputs: []*proto.TxInput{
+			{PrevTxHash: util.RandomHash(), PublicKey: key1.Public().Bytes()},
+			{PrevTxHash: util.RandomHash(), PublicKey: key2.Public().Bytes()},
+		},
+		Outputs: []*proto.TxOutput{{Amount: 10, Address: key1.Public().Address().Bytes()}},
+	}
+	assert.Error(t, SignTransactionInputs(tx, key1))
+
+	sigHash := SigHash(tx)
+	assert.NoError(t, SignTransactionInputs(tx, key1, key2))
+	// The signatures do not take part in the signing hash.
+	assert.Equal(t, sigHash, SigHash(tx))
+
+	// Verification leaves the transaction intact.
+	hash := HashTransaction(tx)
+	assert.True(t, VerifyTransaction(tx))
+	assert.Equal(t, hash, HashTransaction(tx))
+	assert.NotNil(t, tx.Inputs[0].Signature)
+	assert.NotNil(t, tx.Inputs[1].Signature)
+
+	tx.Outputs[0].Amount = 11
+	assert.False(t, VerifyTransaction(tx))
+}
+
+// benchmarkTransactions returns n transactions with ten signed inputs each.
+func benchmarkTransactions(n int) []*proto.Transaction {
+	txx := make([]*proto.Transaction, n)
+	for i := range txx {
+		var (
+			tx   = &proto.Transaction{Version: 1}
+			keys []*crypto.PrivateKey
+		)
+		for j := 0; j < 10; j++ {
+			key := crypto.GeneratePrivateKey()
+			tx.Inputs = append(tx.Inputs, &proto.TxInput{
+				PrevTxHash: util.RandomHash(),
+				PublicKey:  key.Public().Bytes(),
+			})
+			keys = append(keys, key)
+		}
+		tx.Outputs = []*proto.TxOutput{{Amount: 1, Address: keys[0].Public().Address().Bytes()}}
+		if err := SignTransactionInputs(tx, keys...); err != nil {
+			panic(err)
+		}
+		txx[i] = tx
+	}
+	return txx
+}
+
+func BenchmarkVerifyTransaction(b *testing.B) {
+	txx := benchmarkTransactions(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, tx := range txx {
+			if !VerifyTransaction(tx) {
+				b.Fatal("invalid transaction")
+			}
+		}
+	}
+}
+
+func BenchmarkVerifyTransactionBatch(b *testing.B) {
+	txx := benchmarkTransactions(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		v := crypto.NewBatchVerifier(0)
+		for _, tx := range txx {
+			if !AddTransactionSignatures(v, tx) {
+				b.Fatal("invalid transaction")
+			}
+		}
+		if !v.Verify() {
+			b.Fatal("invalid signature")
+		}
+	}
+}
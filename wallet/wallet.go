@@ -0,0 +1,471 @@
+// Package wallet keeps the keys of a user, tracks the outputs they own and
+// builds signed transactions spending them.
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/types"
+)
+
+// ErrInsufficientFunds is returned when the spendable outputs of the wallet
+// don't cover the amount and fee of a transaction.
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// pendingTTL is how long the outputs spent by a created transaction stay
+// reserved if it doesn't make it into a block. It matches the default TTL of
+// the mempool, after which the transaction is dropped.
+const pendingTTL = time.Hour
+
+// ChainReader is the view of the main chain the wallet scans for its outputs.
+// It is satisfied by *node.Chain.
+type ChainReader interface {
+	Height() int
+	GetBlockByHeight(int) (*proto.Block, error)
+}
+
+// utxo is an unspent output owned by one of the keys of the wallet.
+type utxo struct {
+	txHash     []byte
+	index      uint32
+	amount     int64
+	address    []byte
+	lockHeight int32
+}
+
+func (u *utxo) key() string {
+	return outpointKey(u.txHash, u.index)
+}
+
+// outpointKey returns the key of the output at index of the transaction with
+// the given hash.
+func outpointKey(txHash []byte, index uint32) string {
+	return fmt.Sprintf("%s_%d", hex.EncodeToString(txHash), index)
+}
+
+type Wallet struct {
+	lock sync.RWMutex
+	// keys are the keys of the wallet by hex encoded address. The first key
+	// receives the change of the transactions.
+	keys map[string]*crypto.PrivateKey
+	// legacy are the keys by hex encoded legacy address, which may still own
+	// outputs.
+	legacy   map[string]*crypto.PrivateKey
+	change   *crypto.PrivateKey
+	contacts map[string]crypto.Address
+	// prefix is the network prefix of the encoded addresses the wallet
+	// displays and accepts.
+	prefix string
+	// master derives the keys of a wallet restored from a mnemonic, next is
+	// the index of the next derived key.
+	master *crypto.HDKey
+	next   uint32
+	utxos  map[string]*utxo
+	// pending holds the outputs spent by created transactions that are not
+	// in a scanned block yet, with the time their reservation expires.
+	pending map[string]time.Time
+	// height and tip are the height and hash of the last scanned block.
+	height int
+	tip    []byte
+	now    func() time.Time
+}
+
+// New creates a wallet holding the given keys. The first key receives the
+// change of the transactions; without keys a new one is generated.
+func New(keys ...*crypto.PrivateKey) *Wallet {
+	w := &Wallet{
+		keys:     make(map[string]*crypto.PrivateKey),
+		legacy:   make(map[string]*crypto.PrivateKey),
+		contacts: make(map[string]crypto.Address),
+		prefix:   crypto.MainNetPrefix,
+		pending:  make(map[string]time.Time),
+		now:      time.Now,
+	}
+	w.reset()
+
+	if len(keys) == 0 {
+		keys = append(keys, crypto.GeneratePrivateKey())
+	}
+	for _, key := range keys {
+		w.AddKey(key)
+	}
+	return w
+}
+
+// NewFromMnemonic creates a wallet deriving its keys from the mnemonic and the
+// passphrase. It holds the first derived key, further keys are derived by
+// NewKey in the same order, so the mnemonic is the backup of all of them.
+func NewFromMnemonic(mnemonic, passphrase string) (*Wallet, error) {
+	seed, err := crypto.MnemonicToSeed(mnemonic, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	master, err := crypto.NewMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Wallet{
+		keys:     make(map[string]*crypto.PrivateKey),
+		legacy:   make(map[string]*crypto.PrivateKey),
+		contacts: make(map[string]crypto.Address),
+		prefix:   crypto.MainNetPrefix,
+		pending:  make(map[string]time.Time),
+		now:      time.Now,
+		master:   master,
+	}
+	w.reset()
+	w.deriveKey()
+	return w, nil
+}
+
+// AddKey adds the key to the wallet. Outputs it owned before the last scanned
+// block are only found by the next rescan, see Rescan.
+func (w *Wallet) AddKey(key *crypto.PrivateKey) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.addKey(key)
+}
+
+func (w *Wallet) addKey(key *crypto.PrivateKey) {
+	w.keys[hex.EncodeToString(key.Public().Address().Bytes())] = key
+	w.legacy[hex.EncodeToString(key.Public().LegacyAddress().Bytes())] = key
+	if w.change == nil {
+		w.change = key
+	}
+}
+
+// key returns the key owning the address, or nil.
+func (w *Wallet) key(address []byte) *crypto.PrivateKey {
+	if len(address) == crypto.LegacyAddressLen {
+		return w.legacy[hex.EncodeToString(address)]
+	}
+	return w.keys[hex.EncodeToString(address)]
+}
+
+// NewKey adds a new key to the wallet and returns its address. The key is
+// derived from the mnemonic of the wallet if it has one and generated
+// otherwise.
+func (w *Wallet) NewKey() crypto.Address {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	var key *crypto.PrivateKey
+	if w.master != nil {
+		key = w.deriveKey()
+	} else {
+		key = crypto.GeneratePrivateKey()
+		w.addKey(key)
+	}
+	return key.Public().Address()
+}
+
+// deriveKey adds the next key derived from the master key to the wallet.
+func (w *Wallet) deriveKey() *crypto.PrivateKey {
+	hdKey, err := w.master.Derive(crypto.WalletPath(0, w.next))
+	if err != nil {
+		// Only an index beyond the hardened range is rejected.
+		panic(err)
+	}
+	w.next++
+
+	key := hdKey.PrivateKey()
+	w.addKey(key)
+	return key
+}
+
+// Addresses returns the addresses of the keys of the wallet.
+func (w *Wallet) Addresses() []crypto.Address {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	addresses := make([]crypto.Address, 0, len(w.keys))
+	for _, key := range w.keys {
+		addresses = append(addresses, key.Public().Address())
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i].Bytes(), addresses[j].Bytes()) < 0
+	})
+	return addresses
+}
+
+// SetPrefix sets the network prefix of the encoded addresses, which is
+// MainNetPrefix by default.
+func (w *Wallet) SetPrefix(prefix string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.prefix = prefix
+}
+
+// EncodeAddress returns the encoding of the address for the network of the
+// wallet.
+func (w *Wallet) EncodeAddress(address crypto.Address) string {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return address.Encode(w.prefix)
+}
+
+// ParseAddress returns the address stored under the name in the address book,
+// or else decodes the encoded address of the network of the wallet.
+func (w *Wallet) ParseAddress(s string) (crypto.Address, error) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.parseAddress(s)
+}
+
+func (w *Wallet) parseAddress(s string) (crypto.Address, error) {
+	if address, ok := w.contacts[s]; ok {
+		return address, nil
+	}
+	return crypto.ParseAddress(s, w.prefix)
+}
+
+// AddContact stores the encoded address under the name in the address book.
+func (w *Wallet) AddContact(name, address string) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	decoded, err := crypto.ParseAddress(address, w.prefix)
+	if err != nil {
+		return err
+	}
+	w.contacts[name] = decoded
+	return nil
+}
+
+// Contact returns the address stored under the name in the address book.
+func (w *Wallet) Contact(name string) (crypto.Address, bool) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	address, ok := w.contacts[name]
+	return address, ok
+}
+
+// Contacts returns the names in the address book.
+func (w *Wallet) Contacts() []string {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	names := make([]string, 0, len(w.contacts))
+	for name := range w.contacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Sync scans the blocks added to the main chain since the last scan for
+// outputs owned by the wallet and spends of them. If the last scanned block
+// is no longer part of the main chain the whole chain is scanned again.
+func (w *Wallet) Sync(chain ChainReader) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	now := w.now()
+	for key, expiry := range w.pending {
+		if !now.Before(expiry) {
+			delete(w.pending, key)
+		}
+	}
+
+	if w.height >= 0 {
+		b, err := chain.GetBlockByHeight(w.height)
+		if err != nil || !bytes.Equal(types.HashBlock(b), w.tip) {
+			w.reset()
+		}
+	}
+	return w.scan(chain)
+}
+
+// Rescan scans the whole chain again.
+func (w *Wallet) Rescan(chain ChainReader) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.reset()
+	return w.scan(chain)
+}
+
+func (w *Wallet) reset() {
+	w.utxos = make(map[string]*utxo)
+	w.height = -1
+	w.tip = nil
+}
+
+func (w *Wallet) scan(chain ChainReader) error {
+	height := chain.Height()
+	for h := w.height + 1; h <= height; h++ {
+		b, err := chain.GetBlockByHeight(h)
+		if err != nil {
+			return err
+		}
+		w.addBlock(b)
+		w.height = h
+		w.tip = types.HashBlock(b)
+	}
+	return nil
+}
+
+func (w *Wallet) addBlock(b *proto.Block) {
+	for _, tx := range b.Transactions {
+		if !types.IsCoinbase(tx) {
+			for _, input := range tx.Inputs {
+				key := outpointKey(input.PrevTxHash, input.PrevOutIndex)
+				delete(w.utxos, key)
+				delete(w.pending, key)
+			}
+		}
+
+		txHash := types.HashTransaction(tx)
+		for i, output := range tx.Outputs {
+			// Only the outputs locked to a single address of the wallet can
+			// be spent by it.
+			if types.IsMultisigOutput(output) || len(output.LockingScript) > 0 {
+				continue
+			}
+			if w.key(output.Address) == nil {
+				continue
+			}
+			u := &utxo{
+				txHash:     txHash,
+				index:      uint32(i),
+				amount:     output.Amount,
+				address:    output.Address,
+				lockHeight: output.LockHeight,
+			}
+			w.utxos[u.key()] = u
+		}
+	}
+}
+
+// Height returns the height of the last scanned block, or -1 if the chain was
+// not scanned yet.
+func (w *Wallet) Height() int {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.height
+}
+
+// Balance returns the amount of the outputs the wallet can spend in the next
+// block.
+func (w *Wallet) Balance() int64 {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	var balance int64
+	for _, u := range w.spendable() {
+		balance += u.amount
+	}
+	return balance
+}
+
+// spendable returns the outputs that are not timelocked for the next block
+// nor spent by a pending transaction, from the largest to the smallest
+// amount.
+func (w *Wallet) spendable() []*utxo {
+	var (
+		now   = w.now()
+		utxos = make([]*utxo, 0, len(w.utxos))
+	)
+	for _, u := range w.utxos {
+		if expiry, ok := w.pending[u.key()]; ok && now.Before(expiry) {
+			continue
+		}
+		if u.lockHeight <= int32(w.height+1) {
+			utxos = append(utxos, u)
+		}
+	}
+	sort.Slice(utxos, func(i, j int) bool {
+		if utxos[i].amount != utxos[j].amount {
+			return utxos[i].amount > utxos[j].amount
+		}
+		return utxos[i].key() < utxos[j].key()
+	})
+	return utxos
+}
+
+// CreateTransaction builds and signs a transaction paying the amount to the
+// encoded address or contact and the fee to the validator. It selects the
+// largest outputs of the wallet until they cover both and returns the rest as
+// change to the wallet.
+//
+// The selected outputs are reserved until the transaction is part of a
+// scanned block or the reservation expires, so the next transaction doesn't
+// spend them again. The change can only be spent once it is in a block.
+func (w *Wallet) CreateTransaction(to string, amount, fee int64) (*proto.Transaction, error) {
+	if amount <= 0 || fee < 0 || amount > math.MaxInt64-fee {
+		return nil, fmt.Errorf("invalid amount (%d) or fee (%d)", amount, fee)
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	toAddress, err := w.parseAddress(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		target   = amount + fee
+		selected int64
+		tx       = &proto.Transaction{Version: 1}
+		keys     []*crypto.PrivateKey
+	)
+	for _, u := range w.spendable() {
+		if selected >= target {
+			break
+		}
+		key := w.key(u.address)
+		tx.Inputs = append(tx.Inputs, &proto.TxInput{
+			PrevTxHash:   u.txHash,
+			PrevOutIndex: u.index,
+			PublicKey:    key.Public().Bytes(),
+		})
+		keys = append(keys, key)
+		selected += u.amount
+	}
+	if selected < target {
+		return nil, fmt.Errorf("%w: have (%d) - need (%d)", ErrInsufficientFunds, selected, target)
+	}
+
+	tx.Outputs = append(tx.Outputs, &proto.TxOutput{
+		Amount:  amount,
+		Address: toAddress.Bytes(),
+	})
+	if change := selected - target; change > 0 {
+		tx.Outputs = append(tx.Outputs, &proto.TxOutput{
+			Amount:  change,
+			Address: w.change.Public().Address().Bytes(),
+		})
+	}
+
+	if err := types.SignTransactionInputs(tx, keys...); err != nil {
+		return nil, err
+	}
+
+	expiry := w.now().Add(pendingTTL)
+	for _, input := range tx.Inputs {
+		w.pending[outpointKey(input.PrevTxHash, input.PrevOutIndex)] = expiry
+	}
+	return tx, nil
+}
+
+// Release makes the outputs spent by the transaction spendable again, for a
+// created transaction that was never sent or was rejected.
+func (w *Wallet) Release(tx *proto.Transaction) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for _, input := range tx.Inputs {
+		delete(w.pending, outpointKey(input.PrevTxHash, input.PrevOutIndex))
+	}
+}
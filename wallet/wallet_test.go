@@ -0,0 +1,240 @@
+package wallet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vlayco/blockverse/crypto"
+	"github.com/vlayco/blockverse/node"
+	"github.com/vlayco/blockverse/proto"
+	"github.com/vlayco/blockverse/types"
+)
+
+func newChain(t *testing.T) *node.Chain {
+	chain, err := node.NewChain(node.NewMemoryBlockStore(), node.DefaultGenesis())
+	require.NoError(t, err)
+	return chain
+}
+
+// mine adds a block with the transactions on top of the chain.
+func mine(t *testing.T, chain *node.Chain, txx ...*proto.Transaction) {
+	devKey := crypto.NewPrivateKeyFromString(node.DevSeed)
+	tip, err := chain.GetBlockByHeight(chain.Height())
+	require.NoError(t, err)
+
+	height := tip.Header.Height + 1
+	b := &proto.Block{
+		Header: &proto.Header{
+			Version:   1,
+			Height:    height,
+			PrevHash:  types.HashBlock(tip),
+			Timestamp: tip.Header.Timestamp + 1,
+		},
+		Transactions: append([]*proto.Transaction{
+			types.NewCoinbaseTransaction(height, devKey.Public().Address().Bytes(), chain.BlockReward()),
+		}, txx...),
+	}
+	b.Header.RootHash = types.CalculateRootHash(b.Transactions)
+	types.SignBlock(devKey, b)
+	require.NoError(t, chain.AddBlock(b))
+}
+
+func TestCreateTransaction(t *testing.T) {
+	var (
+		chain     = newChain(t)
+		w         = New(crypto.NewPrivateKeyFromString(node.DevSeed))
+		recipient = New()
+	)
+	require.NoError(t, w.Sync(chain))
+	assert.Equal(t, int64(1_000_000), w.Balance())
+
+	_, err := w.CreateTransaction(recipient.EncodeAddress(recipient.Addresses()[0]), 1_000_000, 1)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	// Send 5 and get the rest back as change.
+	tx, err := w.CreateTransaction(recipient.EncodeAddress(recipient.Addresses()[0]), 5, 1)
+	require.NoError(t, err)
+	require.NoError(t, chain.ValidateTransaction(tx))
+	require.Len(t, tx.Outputs, 2)
+	assert.Equal(t, int64(5), tx.Outputs[0].Amount)
+	assert.Equal(t, int64(1_000_000-6), tx.Outputs[1].Amount)
+	assert.Equal(t, w.Addresses()[0].Bytes(), tx.Outputs[1].Address)
+
+	mine(t, chain, tx)
+	require.NoError(t, w.Sync(chain))
+	require.NoError(t, recipient.Sync(chain))
+	// The wallet also owns the coinbase of the block, as the validator.
+	assert.Equal(t, int64(1_000_000-6+50), w.Balance())
+	assert.Equal(t, int64(5), recipient.Balance())
+	assert.Equal(t, 1, w.Height())
+
+	// The recipient can spend its output without change.
+	tx, err = recipient.CreateTransaction(w.EncodeAddress(w.Addresses()[0]), 4, 1)
+	require.NoError(t, err)
+	require.NoError(t, chain.ValidateTransaction(tx))
+	assert.Len(t, tx.Outputs, 1)
+}
+
+func TestCoinSelection(t *testing.T) {
+	var (
+		chain = newChain(t)
+		dev   = New(crypto.NewPrivateKeyFromString(node.DevSeed))
+		w     = New()
+		to    = w.Addresses()[0].Bytes()
+	)
+	require.NoError(t, dev.Sync(chain))
+
+	// Fund the wallet with three outputs.
+	fund := &proto.Transaction{Version: 1}
+	tx, err := dev.CreateTransaction(w.EncodeAddress(w.Addresses()[0]), 10, 0)
+	require.NoError(t, err)
+	fund.Inputs = tx.Inputs
+	for _, amount := range []int64{10, 30, 20} {
+		fund.Outputs = append(fund.Outputs, &proto.TxOutput{Amount: amount, Address: to})
+	}
+	fund.Outputs = append(fund.Outputs, &proto.TxOutput{Amount: 1_000_000 - 60, Address: dev.Addresses()[0].Bytes()})
+	require.NoError(t, types.SignTransactionInputs(fund, crypto.NewPrivateKeyFromString(node.DevSeed)))
+	mine(t, chain, fund)
+	require.NoError(t, w.Sync(chain))
+	assert.Equal(t, int64(60), w.Balance())
+
+	// The largest outputs are selected first.
+	tx, err = w.CreateTransaction(dev.EncodeAddress(dev.Addresses()[0]), 40, 5)
+	require.NoError(t, err)
+	require.Len(t, tx.Inputs, 2)
+	assert.Equal(t, uint32(1), tx.Inputs[0].PrevOutIndex)
+	assert.Equal(t, uint32(2), tx.Inputs[1].PrevOutIndex)
+	assert.Equal(t, int64(5), tx.Outputs[1].Amount)
+	require.NoError(t, chain.ValidateTransaction(tx))
+}
+
+func TestPendingSpends(t *testing.T) {
+	var (
+		chain = newChain(t)
+		w     = New(crypto.NewPrivateKeyFromString(node.DevSeed))
+		to    = w.EncodeAddress(New().Addresses()[0])
+		now   = time.Now()
+	)
+	w.now = func() time.Time { return now }
+	require.NoError(t, w.Sync(chain))
+
+	// The output spent by the first payment isn't selected again.
+	tx, err := w.CreateTransaction(to, 5, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), w.Balance())
+	_, err = w.CreateTransaction(to, 5, 1)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	// A released transaction frees its outputs.
+	w.Release(tx)
+	tx, err = w.CreateTransaction(to, 5, 1)
+	require.NoError(t, err)
+
+	// So does the expiry of the reservation.
+	now = now.Add(pendingTTL)
+	assert.Equal(t, int64(1_000_000), w.Balance())
+	now = now.Add(-pendingTTL)
+
+	// Once the payment is mined the change can be spent.
+	mine(t, chain, tx)
+	require.NoError(t, w.Sync(chain))
+	assert.Empty(t, w.pending)
+	_, err = w.CreateTransaction(to, 5, 1)
+	require.NoError(t, err)
+}
+
+func TestSyncAfterReorg(t *testing.T) {
+	var (
+		chain = newChain(t)
+		w     = New(crypto.NewPrivateKeyFromString(node.DevSeed))
+	)
+	mine(t, chain)
+	require.NoError(t, w.Sync(chain))
+	assert.Equal(t, int64(1_000_050), w.Balance())
+
+	// Rebuild the chain without the block; the wallet notices the different
+	// tip and scans again.
+	chain = newChain(t)
+	require.NoError(t, w.Sync(chain))
+	assert.Equal(t, int64(1_000_000), w.Balance())
+	assert.Equal(t, 0, w.Height())
+}
+
+func TestAddressBook(t *testing.T) {
+	w := New()
+	address := crypto.GeneratePrivateKey().Public().Address()
+
+	_, ok := w.Contact("alice")
+	assert.False(t, ok)
+	require.NoError(t, w.AddContact("alice", address.Encode(crypto.MainNetPrefix)))
+	got, ok := w.Contact("alice")
+	assert.True(t, ok)
+	assert.Equal(t, address, got)
+	assert.Equal(t, []string{"alice"}, w.Contacts())
+
+	// Contacts and encoded addresses are accepted.
+	for _, s := range []string{"alice", address.Encode(crypto.MainNetPrefix)} {
+		got, err := w.ParseAddress(s)
+		require.NoError(t, err)
+		assert.Equal(t, address, got)
+	}
+
+	err := w.AddContact("bob", address.Encode(crypto.TestNetPrefix))
+	assert.ErrorIs(t, err, crypto.ErrWrongNetwork)
+	_, err = w.ParseAddress("not an address")
+	assert.ErrorIs(t, err, crypto.ErrInvalidAddress)
+	legacy := crypto.GeneratePrivateKey().Public().LegacyAddress()
+	_, err = w.ParseAddress(legacy.Encode(crypto.MainNetPrefix))
+	assert.ErrorIs(t, err, crypto.ErrInvalidAddress)
+	w.SetPrefix(crypto.TestNetPrefix)
+	require.NoError(t, w.AddContact("bob", address.Encode(crypto.TestNetPrefix)))
+
+	w.NewKey()
+	assert.Len(t, w.Addresses(), 2)
+}
+
+func TestNewFromMnemonic(t *testing.T) {
+	mnemonic := crypto.GenerateMnemonic()
+
+	w, err := NewFromMnemonic(mnemonic, "")
+	require.NoError(t, err)
+	w.NewKey()
+	w.NewKey()
+	assert.Len(t, w.Addresses(), 3)
+
+	// The restored wallet derives the same keys in the same order.
+	restored, err := NewFromMnemonic(mnemonic, "")
+	require.NoError(t, err)
+	restored.NewKey()
+	restored.NewKey()
+	assert.Equal(t, w.Addresses(), restored.Addresses())
+
+	other, err := NewFromMnemonic(mnemonic, "passphrase")
+	require.NoError(t, err)
+	assert.NotEqual(t, w.Addresses()[:1], other.Addresses())
+
+	_, err = NewFromMnemonic("not a mnemonic", "")
+	assert.ErrorIs(t, err, crypto.ErrInvalidMnemonic)
+}
+
+func TestSpendLegacyOutput(t *testing.T) {
+	var (
+		devKey  = crypto.NewPrivateKeyFromString(node.DevSeed)
+		genesis = node.DefaultGenesis()
+	)
+	genesis.Alloc[0].Address = devKey.Public().LegacyAddress().String()
+	chain, err := node.NewChain(node.NewMemoryBlockStore(), genesis)
+	require.NoError(t, err)
+
+	w := New(devKey)
+	require.NoError(t, w.Sync(chain))
+	assert.Equal(t, int64(1_000_000), w.Balance())
+
+	tx, err := w.CreateTransaction(w.EncodeAddress(New().Addresses()[0]), 5, 1)
+	require.NoError(t, err)
+	require.NoError(t, chain.ValidateTransaction(tx))
+	// The change goes to the versioned address.
+	assert.Equal(t, devKey.Public().Address().Bytes(), tx.Outputs[1].Address)
+}